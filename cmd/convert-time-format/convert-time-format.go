@@ -29,10 +29,12 @@ func main() {
 	transfer, err := NewS3Transfer(endpoint, bucketName, accessKeyID, secretAccessKey)
 	CheckError(err)
 	s3Transfer := transfer.(*S3Transfer)
-	ch := transfer.ListFile("")
+	ch := transfer.ListFileInfo("")
 	sourceToDest := map[string]string{}
 	_, offset := time.Now().Zone()
-	for name := range ch {
+	for info := range ch {
+		CheckError(info.Err)
+		name := info.Name
 		if !strings.HasSuffix(name, ".zip") {
 			continue
 		}
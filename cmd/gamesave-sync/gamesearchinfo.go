@@ -11,6 +11,8 @@ import (
 	"strings"
 
 	"github.com/chenjianlong/gamesave-sync/pkg/gsutils"
+	"github.com/chenjianlong/gamesave-sync/pkg/syncer"
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
 	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
 )
@@ -29,14 +31,50 @@ type RegistryInfo struct {
 	Name    string
 }
 
+// SearchRule locates one directory of a game save.
+type SearchRule struct {
+	Type        SearchType             `json:"searchType"`
+	KnownFolder string                 `json:"knownFolderID"`
+	FolderID    *windows.KNOWNFOLDERID `json:"-"`
+	Reg         *RegistryInfo          `json:"registry"`
+	Dir         string                 `json:"dir"`
+	SubDir      string                 `json:"subdir"`
+	// Include and Exclude are glob patterns selecting the files of the game save
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// Files are glob patterns of the files directly in the directory which make up the
+	// game save, the rest of the directory is left alone.
+	Files []string `json:"files"`
+	// File marks that the path names the save file itself rather than a directory, so it's
+	// synced on a device where the file doesn't exist yet
+	File bool `json:"file"`
+}
+
+// ComponentSearchInfo is one named save location of a game which spreads its save over
+// several directories, such as saves in Documents and settings in AppData.
+type ComponentSearchInfo struct {
+	Name string `json:"name"`
+	SearchRule
+}
+
 type GameSearchInfo struct {
-	Name     string     `json:"name"`
-	Type     SearchType `json:"searchType"`
-	FolderID *windows.KNOWNFOLDERID
-	Reg      *RegistryInfo `json:"registry"`
-	Dir      string        `json:"dir"`
-	SubDir   string        `json:"subdir"`
-	ProcName string        `json:"procName"`
+	Name string `json:"name"`
+	// SearchRule locates the game save of a game with one save location
+	SearchRule
+	Components []ComponentSearchInfo `json:"components"`
+	ProcName   string                `json:"procName"`
+	// ArchiveFormat is one of zip, zip-store and tar.zst, defaults to zip
+	ArchiveFormat    string `json:"archiveFormat"`
+	CompressionLevel int    `json:"compressionLevel"`
+	// Retention overrides the retention policy of config.ini
+	Retention *syncer.RetentionRule `json:"retention"`
+	// Enabled defaults to true, the [games] section of config.ini overrides it
+	Enabled *bool `json:"enabled"`
+	// Devices are the names or IDs of the devices which sync the game, every device if it's empty
+	Devices []string `json:"devices"`
+	// Direction is bidirectional, push-only, pull-only or backup-only, defaults to bidirectional,
+	// the [direction] section of config.ini overrides it
+	Direction string `json:"direction"`
 }
 
 func toKnownFolderID(folderID string) (*windows.KNOWNFOLDERID, error) {
@@ -325,7 +363,7 @@ func toKnownFolderID(folderID string) (*windows.KNOWNFOLDERID, error) {
 	case "AppDataProgramData":
 		knownFolderID = windows.FOLDERID_AppDataProgramData
 	default:
-		return nil, fmt.Errorf("unknown FOLDERID: %#v", knownFolderID)
+		return nil, fmt.Errorf("unknown FOLDERID: %s", folderID)
 	}
 
 	return knownFolderID, nil
@@ -396,6 +434,66 @@ func (t *RegistryInfo) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// init validates the rule and resolves its known folder ID.
+func (r *SearchRule) init() error {
+	switch r.Type {
+	case STKnownFolder:
+		folderID, err := toKnownFolderID(r.KnownFolder)
+		if err != nil {
+			return err
+		}
+
+		r.FolderID = folderID
+	case STRegistry:
+		if r.Reg == nil {
+			return fmt.Errorf("registry is required by registry search type")
+		}
+	case STFolder:
+		if r.Dir == `` {
+			return fmt.Errorf("dir is required by folder search type")
+		}
+	default:
+		return fmt.Errorf("invalid search type: %d", r.Type)
+	}
+
+	if r.SubDir == `` && len(r.Files) == 0 {
+		return fmt.Errorf("subdir is required")
+	}
+
+	return nil
+}
+
+// resolve returns the directory located by the rule, ok is false if it can't be located.
+func (r *SearchRule) resolve() (dir string, ok bool) {
+	switch r.Type {
+	case STKnownFolder:
+		var err error
+		dir, err = windows.KnownFolderPath(r.FolderID, 0)
+		if err != nil {
+			log.Printf("Failed to get known folder %s, err=%s\n", r.KnownFolder, err)
+			return ``, false
+		}
+	case STRegistry:
+		key, err := registry.OpenKey(r.Reg.RootKey, r.Reg.Key, registry.QUERY_VALUE|registry.WOW64_64KEY)
+		if err != nil {
+			return ``, false
+		}
+
+		dir, _, err = key.GetStringValue(r.Reg.Name)
+		if err != nil {
+			return ``, false
+		}
+	case STFolder:
+		dir = r.Dir
+	}
+
+	if dir == `` {
+		return ``, false
+	}
+
+	return filepath.Join(dir, r.SubDir), true
+}
+
 func LoadGameSearchInfo(path string) *GameSearchInfo {
 	file, err := os.Open(path)
 	if err != nil {
@@ -405,7 +503,11 @@ func LoadGameSearchInfo(path string) *GameSearchInfo {
 
 	defer file.Close()
 	content, err := io.ReadAll(file)
-	gsutils.CheckError(err)
+	if err != nil {
+		log.Printf("Failed to read %s, err=%s\n", path, err)
+		return nil
+	}
+
 	searchInfo := new(GameSearchInfo)
 	err = json.Unmarshal(content, searchInfo)
 	if err != nil {
@@ -413,39 +515,42 @@ func LoadGameSearchInfo(path string) *GameSearchInfo {
 		return nil
 	}
 
-	obj := map[string]interface{}{}
-	err = json.Unmarshal(content, &obj)
-	if err != nil {
-		log.Printf("Failed to unmarshal to json： %s\n", hex.Dump(content))
+	if searchInfo.Name == `` {
+		log.Printf("Invalid game search info, name is required： %s\n", path)
 		return nil
 	}
 
-	// Parse knownFolderID, TODO find better way
-	if knownFolderID, ok := obj["knownFolderID"]; ok {
-		if _, ok := knownFolderID.(string); ok {
-			searchInfo.FolderID, err = toKnownFolderID(knownFolderID.(string))
-			if err != nil {
-				log.Printf("Failed to convert string to FolderID, str=%s\n", knownFolderID.(string))
-				return nil
-			}
+	if len(searchInfo.Components) == 0 {
+		if err = searchInfo.SearchRule.init(); err != nil {
+			log.Printf("Invalid game search info %s, err=%s\n", path, err)
+			return nil
 		}
+
+		return searchInfo
 	}
 
-	if searchInfo.Reg == nil && searchInfo.FolderID == nil {
-		log.Printf("Invalid game search info： %s\n", hex.Dump(content))
-		return nil
+	names := map[string]bool{}
+	for i := range searchInfo.Components {
+		component := &searchInfo.Components[i]
+		if component.Name == `` || component.Name == `.` || component.Name == `..` ||
+			strings.ContainsAny(component.Name, `/\`) || names[component.Name] {
+			log.Printf("Invalid game search info %s, invalid component name: %q\n", path, component.Name)
+			return nil
+		}
+
+		names[component.Name] = true
+		if err = component.init(); err != nil {
+			log.Printf("Invalid game search info %s, component %s, err=%s\n", path, component.Name, err)
+			return nil
+		}
 	}
 
 	return searchInfo
 }
 
-type GameInfo struct {
-	Name     string
-	Dir      string
-	ProcName string
-}
-
-func LoadGameList(confDir string) []GameInfo {
+// LoadGameList returns the games found by the search info in confDir, the invalid search info
+// and the games not found are skipped.
+func LoadGameList(confDir string) ([]syncer.GameInfo, error) {
 	var gameSearchInfo []*GameSearchInfo
 	err := filepath.Walk(confDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -462,47 +567,86 @@ func LoadGameList(confDir string) []GameInfo {
 		return nil
 	})
 
-	gsutils.CheckError(err)
-	var gameList []GameInfo
+	if err != nil {
+		return nil, err
+	}
+
+	var gameList []syncer.GameInfo
 	for _, info := range gameSearchInfo {
-		if info.Name == `` || info.SubDir == `` {
-			log.Printf("Invalid search info: %#v\n", info)
+		format, err := ziputils.ParseFormat(info.ArchiveFormat)
+		if err != nil {
+			log.Printf("Invalid search info: %#v, err=%s\n", info, err)
 			continue
 		}
 
-		var dir string
-		switch info.Type {
-		case STKnownFolder:
-			dir, err = windows.KnownFolderPath(info.FolderID, 0)
-			gsutils.CheckError(err)
-		case STRegistry:
-			key, err := registry.OpenKey(info.Reg.RootKey, info.Reg.Key, registry.QUERY_VALUE|registry.WOW64_64KEY)
-			if err != nil {
+		direction, err := syncer.ParseDirection(info.Direction)
+		if err != nil {
+			log.Printf("Invalid search info: %#v, err=%s\n", info, err)
+			continue
+		}
+
+		rules := info.Components
+		if len(rules) == 0 {
+			rules = []ComponentSearchInfo{{SearchRule: info.SearchRule}}
+		}
+
+		var components []syncer.Component
+		found := false
+		for _, rule := range rules {
+			dir, ok := rule.resolve()
+			if !ok {
 				continue
 			}
 
-			dir, _, err = key.GetStringValue(info.Reg.Name)
+			files := rule.Files
+			if info, err := os.Stat(dir); rule.File || (err == nil && info.Mode().IsRegular()) {
+				// subdir names the save file itself
+				files = []string{escapePattern(filepath.Base(dir))}
+				dir = filepath.Dir(dir)
+			}
+
+			filter, err := ziputils.NewFilter(rule.Include, rule.Exclude, files)
 			if err != nil {
-				continue
+				log.Printf("Invalid search info: %#v, err=%s\n", info, err)
+				components = nil
+				break
+			}
+
+			components = append(components, syncer.Component{Name: rule.Name, Dir: dir, Filter: filter})
+			if valid, _ := gsutils.IsDir(dir); valid {
+				found = true
 			}
-		case STFolder:
-			dir = info.Dir
-		default:
-			log.Fatalf("Invalid search type: %d\n", info.Type)
 		}
 
-		if dir == `` {
+		if !found || len(components) != len(rules) {
 			continue
 		}
 
-		dir = filepath.Join(dir, info.SubDir)
-		valid, _ := gsutils.IsDir(dir)
-		if !valid {
-			continue
+		gameList = append(gameList, syncer.GameInfo{
+			Name:       info.Name,
+			Components: components,
+			ProcName:   info.ProcName,
+			Archive:    ziputils.Options{Format: format, Level: info.CompressionLevel},
+			Retention:  info.Retention,
+			Enabled:    info.Enabled == nil || *info.Enabled,
+			Devices:    info.Devices,
+			Direction:  direction,
+		})
+	}
+
+	return gameList, nil
+}
+
+// escapePattern quotes the glob meta characters of a file name.
+func escapePattern(name string) string {
+	var b strings.Builder
+	for _, c := range name {
+		if strings.ContainsRune(`*?[\\`, c) {
+			b.WriteRune('\\')
 		}
 
-		gameList = append(gameList, GameInfo{info.Name, dir, info.ProcName})
+		b.WriteRune(c)
 	}
 
-	return gameList
+	return b.String()
 }
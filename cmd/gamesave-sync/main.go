@@ -1,261 +1,544 @@
 package main
 
 import (
+	"bufio"
 	"errors"
+	"fmt"
 	"log"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/alexflint/go-arg"
-	"github.com/fsnotify/fsnotify"
 	"gopkg.in/ini.v1"
 
-	"github.com/chenjianlong/gamesave-sync/pkg/gsutils"
 	"github.com/chenjianlong/gamesave-sync/pkg/i18n"
+	"github.com/chenjianlong/gamesave-sync/pkg/syncer"
 	"github.com/chenjianlong/gamesave-sync/pkg/transfer"
 	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
 	"github.com/jeandeaual/go-locale"
-	"github.com/mitchellh/go-ps"
 	"golang.org/x/sys/windows"
 )
 
 const AppName = "GameSaveSyncing"
 
+type resolveCmd struct {
+	Game   string `arg:"positional,required" help:"game name"`
+	Choice string `arg:"positional,required" help:"keep-local, keep-remote or keep-both"`
+}
+
+type statusCmd struct{}
+
+type undoCmd struct {
+	Game string `arg:"positional,required" help:"game name"`
+}
+
+type pruneCmd struct {
+	Game string `arg:"positional" help:"game name, every game if it's empty"`
+}
+
+type listCmd struct {
+	Game string `arg:"positional" help:"game name, every game if it's empty"`
+	JSON bool   `arg:"--json" help:"print as JSON"`
+}
+
+type diffCmd struct {
+	Game      string   `arg:"positional,required" help:"game name"`
+	Snapshots []string `arg:"positional" help:"one snapshot to compare the local game save with, the latest one by default, or two snapshots to compare with each other"`
+	Text      bool     `arg:"-u,--text" help:"show the unified diff of modified text files"`
+}
+
+type restoreCmd struct {
+	Game     string `arg:"positional" help:"game name"`
+	Snapshot string `arg:"positional" help:"snapshot name, a prefix of it such as its time, or ~N for N versions ago"`
+	At       string `arg:"--at" help:"restore every game to its latest snapshot at the date, such as 2024-01-31 or \"2024-01-31 20:00\""`
+	Yes      bool   `arg:"-y,--yes" help:"replace the local game saves without confirmation"`
+}
+
+type pinCmd struct {
+	Game     string `arg:"positional,required" help:"game name"`
+	Snapshot string `arg:"positional,required" help:"snapshot name, a prefix of it such as its time, or ~N for N versions ago"`
+}
+
+type labelCmd struct {
+	Game     string  `arg:"positional,required" help:"game name"`
+	Snapshot string  `arg:"positional,required" help:"snapshot name, a prefix of it such as its time, or ~N for N versions ago"`
+	Label    string  `arg:"positional,required" help:"label such as \"before final boss\", empty to clear it"`
+	Note     *string `arg:"positional" help:"note of the snapshot, kept if it's not given and cleared if it's empty"`
+}
+
+type cliArgs struct {
+	Path     string      `arg:"-p" default:"config.ini" help:"config path"`
+	DryRun   bool        `arg:"--dry-run" help:"print how every game would be synced and why, without changing anything"`
+	Game     []string    `arg:"--game,separate" help:"only the game, it may be given more than once"`
+	Exclude  []string    `arg:"--exclude-game,separate" help:"every game but the game, it may be given more than once"`
+	Jobs     int         `arg:"-j,--jobs" default:"4" help:"number of games synced at the same time"`
+	Label    string      `arg:"--label" help:"label of the game saves uploaded by this sync, such as \"before final boss\""`
+	Note     string      `arg:"--note" help:"note of the game saves uploaded by this sync"`
+	Resolve  *resolveCmd `arg:"subcommand:resolve" help:"resolve the conflict of a game save changed both locally and remotely"`
+	Status   *statusCmd  `arg:"subcommand:status" help:"show the last sync of every game"`
+	Undo     *undoCmd    `arg:"subcommand:undo" help:"put back the game save as it was before the last download"`
+	Prune    *pruneCmd   `arg:"subcommand:prune" help:"remove the snapshots beyond the retention policy"`
+	List     *listCmd    `arg:"subcommand:list" help:"list the remote snapshots of every game, the latest first"`
+	History  *listCmd    `arg:"subcommand:history" help:"same as list"`
+	Diff     *diffCmd    `arg:"subcommand:diff" help:"show the changes from the local game save to a snapshot, or between two snapshots"`
+	Restore  *restoreCmd `arg:"subcommand:restore" help:"restore an earlier snapshot of a game, or of every game at a date"`
+	Pin      *pinCmd     `arg:"subcommand:pin" help:"keep a snapshot from being pruned"`
+	Unpin    *pinCmd     `arg:"subcommand:unpin" help:"allow a pinned snapshot to be pruned"`
+	SetLabel *labelCmd   `arg:"subcommand:label" help:"set the label and the note of a snapshot"`
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	var args struct {
-		Path string `arg:"-p" default:"config.ini" help:"config path"`
-	}
-
+	var args cliArgs
 	arg.MustParse(&args)
+	if err := run(&args); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
 
+// run runs the command given by args, a sync fails if any game fails to sync.
+func run(args *cliArgs) error {
 	loc, err := locale.GetLocale()
-	gsutils.CheckError(err)
-	i18n.InitBundle(loc)
+	if err != nil {
+		return err
+	}
 
-	transfer := newTransfer(args.Path)
-	appData := getAppdata()
-	hasMonitor := false
-	for _, info := range LoadGameList("conf.d/") {
-		log.Println(i18n.GetSyncGameMessage(info.Name))
-		p := info.Dir
-		valid, _ := gsutils.IsDir(p)
-		if !valid {
-			log.Printf("%s not exist\n", p)
-			continue
+	if err = i18n.InitBundle(loc); err != nil {
+		return err
+	}
+
+	cfg, err := ini.Load(args.Path)
+	if err != nil {
+		return err
+	}
+
+	appData, err := getAppdata()
+	if err != nil {
+		return err
+	}
+
+	s, err := newSyncer(cfg, appData)
+	if err != nil {
+		return err
+	}
+
+	if changesGameSaves(args) {
+		s.RecoverRestores()
+	}
+
+	gameList, err := LoadGameList("conf.d/")
+	if err != nil {
+		return err
+	}
+
+	games := selectGames(gameList, newGameSwitches(cfg), s.Device(), args.Game, args.Exclude)
+	setDirections(games, newGameDirections(cfg))
+	if args.Status != nil {
+		return s.PrintStatus(os.Stdout, games)
+	}
+
+	if args.Undo != nil {
+		info, err := findGame(games, args.Undo.Game)
+		if err != nil {
+			return err
 		}
 
-		localGameSaveTime := getLocalGameSaveTime(info.Dir)
-		downloadObjName, needUpload := getDownloadName(transfer, localGameSaveTime, info.Name+"/")
-		log.Printf("Game: %s, needUpload: %v, downloadObject: %s\n", info.Name, needUpload, downloadObjName)
-		zipPath := filepath.Join(appData, info.Name+".zip")
-		if needUpload && localGameSaveTime != nil {
-			objName := path.Join(info.Name, localGameSaveTime.UTC().Format(gsutils.TimeFormat)+".zip")
-			uploadGameSave(transfer, p, zipPath, objName)
+		return s.UndoDownload(info)
+	}
+
+	t, err := newTransfer(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.SetTransfer(t)
+
+	switch {
+	case args.Prune != nil:
+		failed := 0
+		for _, info := range games {
+			if args.Prune.Game != "" && info.Name != args.Prune.Game {
+				continue
+			}
+
+			if err := s.Prune(info); err != nil {
+				log.Printf("Failed to prune %s, err=%s\n", info.Name, err)
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("failed to prune %d games", failed)
+		}
+
+		return nil
+	case args.List != nil || args.History != nil:
+		cmd := args.List
+		if cmd == nil {
+			cmd = args.History
+		}
+
+		listings := []syncer.SnapshotListing{}
+		for _, info := range games {
+			if cmd.Game == "" || info.Name == cmd.Game {
+				gameListings, err := s.ListGame(info)
+				if err != nil {
+					return err
+				}
+
+				listings = append(listings, gameListings...)
+			}
+		}
+
+		return syncer.PrintListings(os.Stdout, listings, cmd.JSON)
+	case args.Diff != nil:
+		from, to := "", "~0"
+		switch len(args.Diff.Snapshots) {
+		case 0:
+		case 1:
+			to = args.Diff.Snapshots[0]
+		case 2:
+			from, to = args.Diff.Snapshots[0], args.Diff.Snapshots[1]
+		default:
+			return errors.New("at most two snapshots are compared")
 		}
 
-		if downloadObjName != "" {
-			downloadGameSave(transfer, p, zipPath, downloadObjName)
+		info, err := findGame(games, args.Diff.Game)
+		if err != nil {
+			return err
 		}
 
+		return s.DiffSnapshots(os.Stdout, info, from, to, args.Diff.Text)
+	case args.Restore != nil:
+		return restoreCommand(s, games, args.Restore)
+	case args.Pin != nil || args.Unpin != nil:
+		cmd := args.Pin
+		if cmd == nil {
+			cmd = args.Unpin
+		}
+
+		info, err := findGame(games, cmd.Game)
+		if err != nil {
+			return err
+		}
+
+		return s.SetPinned(info, cmd.Snapshot, args.Pin != nil)
+	case args.SetLabel != nil:
+		info, err := findGame(games, args.SetLabel.Game)
+		if err != nil {
+			return err
+		}
+
+		return s.SetLabel(info, args.SetLabel.Snapshot, args.SetLabel.Label, args.SetLabel.Note)
+	case args.Resolve != nil:
+		info, err := findGame(games, args.Resolve.Game)
+		if err != nil {
+			return err
+		}
+
+		return s.ResolveConflict(info, syncer.ResolveChoice(args.Resolve.Choice))
+	case args.DryRun:
+		return s.PrintPlans(os.Stdout, games)
+	}
+
+	s.CheckClockSkew()
+	s.SetUploadLabel(args.Label, args.Note)
+	syncErr := s.SyncGames(os.Stdout, games, args.Jobs)
+	// The label is only meant for the game saves of this sync, not the ones uploaded by the monitors.
+	s.SetUploadLabel("", "")
+	hasMonitor := false
+	for _, info := range games {
 		if info.ProcName != "" {
-			go monitorDir(args.Path, info)
+			go s.Monitor(info)
 			hasMonitor = true
 		}
 	}
 
 	if hasMonitor {
+		// The exit code can't tell the failure since the monitors never exit.
+		if syncErr != nil {
+			log.Println(syncErr)
+		}
+
 		// Block main goroutine forever.
 		<-make(chan struct{})
 	}
+
+	return syncErr
 }
 
-func monitorDir(iniPath string, info GameInfo) {
-	watcher, err := fsnotify.NewWatcher()
+func restoreCommand(s *syncer.Syncer, games []syncer.GameInfo, cmd *restoreCmd) error {
+	var plans []*syncer.RestorePlan
+	if cmd.At == "" {
+		if cmd.Game == "" || cmd.Snapshot == "" {
+			return errors.New("game and snapshot are required without --at")
+		}
+
+		info, err := findGame(games, cmd.Game)
+		if err != nil {
+			return err
+		}
+
+		plan, err := s.PlanRestore(info, cmd.Snapshot, time.Time{})
+		if err != nil {
+			return err
+		}
+
+		return restoreGames(s, []*syncer.RestorePlan{plan}, cmd.Yes)
+	}
+
+	at, err := syncer.ParseDate(cmd.At)
 	if err != nil {
-		log.Fatal(err)
-	}
-	defer watcher.Close()
-
-	// Start listening for events.
-	go func() {
-		fatalError := false
-		gameSaveModify := false
-		for !fatalError {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
+		return err
+	}
 
-				if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
-					log.Println("modified file:", event.Name)
-					gameSaveModify = true
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					fatalError = true
-				}
-				log.Println("error:", err)
-			case <-time.After(time.Second * 5):
-				break
-			}
+	failed := 0
+	for _, info := range games {
+		if cmd.Game != "" && info.Name != cmd.Game {
+			continue
+		}
 
-			if gameSaveModify {
-				uploadGameSaveIfGameExited(iniPath, info)
-			}
+		plan, err := s.PlanRestore(info, "", at)
+		if err != nil {
+			log.Printf("Failed to plan the restore of %s, err=%s\n", info.Name, err)
+			failed++
+			continue
 		}
-	}()
 
-	// Add a path.
-	gsutils.CheckError(watcher.Add(info.Dir))
-	// TODO exit if watcher is error on monitor
-	<-make(chan struct{})
+		if plan != nil {
+			plans = append(plans, plan)
+		}
+	}
+
+	if err = restoreGames(s, plans, cmd.Yes); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to plan the restore of %d games", failed)
+	}
+
+	return nil
 }
 
-func processRunning(name string) bool {
-	processes, err := ps.Processes()
-	gsutils.CheckError(err)
-	for _, proc := range processes {
-		if proc.Executable() == name {
-			return true
+// restoreGames restores the planned snapshots after the user confirms it unless yes is true.
+func restoreGames(s *syncer.Syncer, plans []*syncer.RestorePlan, yes bool) error {
+	if len(plans) == 0 {
+		log.Println("Nothing to restore")
+		return nil
+	}
+
+	syncer.PrintRestorePlans(os.Stdout, plans)
+	if !yes && !confirm("The local game saves above will be replaced, continue?") {
+		return nil
+	}
+
+	return s.RestoreGames(os.Stdout, plans)
+}
+
+// confirm asks the user the question, it's true if the answer is yes.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// changesGameSaves reports whether the command given by args changes the local game saves, the
+// restores interrupted by the last run are only recovered before such a command.
+func changesGameSaves(args *cliArgs) bool {
+	switch {
+	case args.Undo != nil, args.Restore != nil, args.Resolve != nil:
+		return true
+	case args.DryRun, args.Status != nil, args.List != nil, args.History != nil, args.Diff != nil, args.Prune != nil,
+		args.Pin != nil, args.Unpin != nil, args.SetLabel != nil:
+		return false
+	default:
+		return true
+	}
+}
+
+// findGame returns the found game named name.
+func findGame(games []syncer.GameInfo, name string) (syncer.GameInfo, error) {
+	for _, info := range games {
+		if info.Name == name {
+			return info, nil
 		}
 	}
 
-	return false
+	return syncer.GameInfo{}, fmt.Errorf("game %s is not found or not enabled on this device", name)
 }
 
-func uploadGameSaveIfGameExited(iniPath string, info GameInfo) {
-	if processRunning(info.ProcName) {
-		return
+// selectGames returns the games enabled on this device, by conf.d and by switches which override it,
+// and selected by the command line. Every enabled game is selected unless include is given.
+func selectGames(games []syncer.GameInfo, switches map[string]bool, device syncer.DeviceInfo, include, exclude []string) []syncer.GameInfo {
+	found := map[string]bool{}
+	for _, info := range games {
+		found[info.Name] = true
 	}
 
-	zipPath := filepath.Join(getAppdata(), info.Name+".zip")
-	localGameSaveTime := getLocalGameSaveTime(info.Dir)
-	objName := path.Join(info.Name, localGameSaveTime.UTC().Format(gsutils.TimeFormat)+".zip")
-	uploadGameSave(newTransfer(iniPath), info.Dir, zipPath, objName)
+	for _, name := range append(include, exclude...) {
+		if !found[name] {
+			log.Printf("Game %s is not found\n", name)
+		}
+	}
+
+	var selected []syncer.GameInfo
+	for _, info := range games {
+		enabled := info.Enabled
+		if switched, ok := switches[info.Name]; ok {
+			enabled = switched
+		}
+
+		switch {
+		case !enabled:
+			log.Printf("Game %s is disabled\n", info.Name)
+		case !device.Matches(info.Devices):
+			log.Printf("Game %s is not synced on this device\n", info.Name)
+		case len(include) > 0 && !containsString(include, info.Name), containsString(exclude, info.Name):
+		default:
+			selected = append(selected, info)
+		}
+	}
+
+	return selected
+}
+
+// setDirections overrides the directions of the games by directions.
+func setDirections(games []syncer.GameInfo, directions map[string]syncer.Direction) {
+	for i := range games {
+		if direction, ok := directions[games[i].Name]; ok {
+			games[i].Direction = direction
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
 }
 
-func newTransfer(path string) transfer.Transfer {
-	iniFile, err := ini.Load(path)
-	gsutils.CheckError(err)
-	s3Section, err := iniFile.GetSection("s3")
+func newTransfer(cfg *ini.File) (transfer.Transfer, error) {
+	s3Section, err := cfg.GetSection("s3")
 	if err == nil {
 		endpoint := s3Section.Key("endpoint").String()
 		bucketName := s3Section.Key("bucketName").String()
 		accessKeyID := s3Section.Key("accessKeyID").String()
 		secretAccessKey := s3Section.Key("secretAccessKey").String()
-		transfer, err := transfer.NewS3Transfer(endpoint, bucketName, accessKeyID, secretAccessKey)
-		gsutils.CheckError(err)
-		return transfer
+		return transfer.NewS3Transfer(endpoint, bucketName, accessKeyID, secretAccessKey)
 	}
 
-	ftpSection, err := iniFile.GetSection("ftp")
+	ftpSection, err := cfg.GetSection("ftp")
 	if err == nil {
 		addr := ftpSection.Key("addr").String()
 		user := ftpSection.Key("user").String()
 		password := ftpSection.Key("password").String()
 		subDir := ftpSection.Key("subDir").String()
-		transfer, err := transfer.NewFTPTransfer(addr, user, password, subDir)
-		gsutils.CheckError(err)
-		return transfer
+		return transfer.NewFTPTransfer(addr, user, password, subDir)
 	}
 
-	panic("Invalid config no s3 and ftp section")
+	return nil, errors.New("invalid config, no s3 or ftp section")
 }
 
-func getDownloadName(transfer transfer.Transfer, localTime *time.Time, dir string) (string, bool) {
-	needUpload := false
-	var downloadTime time.Time
-	if localTime != nil {
-		needUpload = true
-		downloadTime = *localTime
+// newLimits returns the archive safety limits of the [limits] section, the defaults
+// are used for missing keys.
+func newLimits(cfg *ini.File) ziputils.Limits {
+	section := cfg.Section("limits")
+	return ziputils.Limits{
+		MaxSize:    section.Key("maxSize").MustInt64(ziputils.DefaultLimits.MaxSize),
+		MaxEntries: section.Key("maxEntries").MustInt(ziputils.DefaultLimits.MaxEntries),
+		MaxRatio:   section.Key("maxRatio").MustFloat64(ziputils.DefaultLimits.MaxRatio),
 	}
-	downloadObjName := ""
-	for file := range transfer.ListFile(dir) {
-		if !strings.HasSuffix(file, ".zip") {
-			continue
-		}
+}
+
+// newBackupPolicy returns the policy of the local backups of the [backup] section, the defaults
+// are used for missing keys.
+func newBackupPolicy(cfg *ini.File) syncer.BackupPolicy {
+	section := cfg.Section("backup")
+	return syncer.BackupPolicy{
+		MaxCount: section.Key("maxCount").MustInt(syncer.DefaultBackupPolicy.MaxCount),
+		MaxSize:  section.Key("maxSize").MustInt64(syncer.DefaultBackupPolicy.MaxSize),
+	}
+}
 
-		objTime, err := time.Parse(gsutils.TimeFormat, strings.TrimPrefix(strings.TrimSuffix(file, ".zip"), dir))
+// newRetentionPolicy returns the retention policy of the [retention] section, every snapshot
+// is kept by default.
+func newRetentionPolicy(cfg *ini.File) syncer.RetentionPolicy {
+	section := cfg.Section("retention")
+	return syncer.RetentionPolicy{
+		KeepLast:         section.Key("keepLast").MustInt(0),
+		KeepDaily:        section.Key("keepDaily").MustInt(0),
+		KeepWeekly:       section.Key("keepWeekly").MustInt(0),
+		KeepMonthly:      section.Key("keepMonthly").MustInt(0),
+		MaxSize:          section.Key("maxSize").MustInt64(0),
+		PruneAfterUpload: section.Key("pruneAfterUpload").MustBool(false),
+	}
+}
+
+// newGameSwitches returns the games enabled or disabled by the [games] section.
+func newGameSwitches(cfg *ini.File) map[string]bool {
+	switches := map[string]bool{}
+	for _, key := range cfg.Section("games").Keys() {
+		enabled, err := key.Bool()
 		if err != nil {
-			log.Printf("Failed to parse time %s\n", file)
+			log.Printf("Invalid [games] %s = %s, expect true or false\n", key.Name(), key.String())
 			continue
 		}
 
-		if localTime != nil && localTime.Unix() == objTime.Unix() {
-			needUpload = false
-		} else if objTime.After(downloadTime) {
-			downloadObjName = file
-			downloadTime = objTime
-		}
+		switches[key.Name()] = enabled
 	}
 
-	return downloadObjName, needUpload
+	return switches
 }
 
-func getLocalGameSaveTime(dir string) *time.Time {
-	var mtime *time.Time = nil
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+// newGameDirections returns the sync directions of the games set by the [direction] section.
+func newGameDirections(cfg *ini.File) map[string]syncer.Direction {
+	directions := map[string]syncer.Direction{}
+	for _, key := range cfg.Section("direction").Keys() {
+		direction, err := syncer.ParseDirection(key.String())
 		if err != nil {
-			return err
-		}
-
-		if info.Mode().IsRegular() {
-			if mtime == nil {
-				mtime = new(time.Time)
-			}
-
-			if info.ModTime().After(*mtime) {
-				*mtime = info.ModTime()
-			}
+			log.Printf("Invalid [direction] %s = %s, err=%s\n", key.Name(), key.String(), err)
+			continue
 		}
 
-		return nil
-	})
+		directions[key.Name()] = direction
+	}
 
-	gsutils.CheckError(err)
-	return mtime
+	return directions
 }
 
-func getAppdata() string {
-	appData, err := windows.KnownFolderPath(windows.FOLDERID_RoamingAppData, 0)
-	gsutils.CheckError(err)
-	appData = filepath.Join(appData, AppName)
-	gsutils.CheckError(os.MkdirAll(appData, 0755))
-	return appData
-}
-
-func uploadGameSave(uploader transfer.Uploader, p, zipPath, objName string) {
-	err := ziputils.ZipSource(p, zipPath)
-	gsutils.CheckError(err)
-	defer func() {
-		err = os.Remove(zipPath)
-		if err != nil {
-			log.Println(err)
-		}
-	}()
+// newSyncer returns the syncer of the game saves configured by cfg, without the remote storage.
+// The name of this device is set by the [device] section and defaults to the host name.
+func newSyncer(cfg *ini.File, appData string) (*syncer.Syncer, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
 
-	gsutils.CheckError(uploader.Upload(zipPath, objName))
-	log.Printf("Successfully uploaded %s\n", objName)
+	return syncer.New(syncer.Options{
+		AppData:    appData,
+		Limits:     newLimits(cfg),
+		Backup:     newBackupPolicy(cfg),
+		Retention:  newRetentionPolicy(cfg),
+		DeviceName: cfg.Section("device").Key("name").String(),
+		Hostname:   hostname,
+	})
 }
 
-func downloadGameSave(downloader transfer.Downloader, p, zipPath, objName string) {
-	err := os.Remove(zipPath)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		panic(err)
+func getAppdata() (string, error) {
+	appData, err := windows.KnownFolderPath(windows.FOLDERID_RoamingAppData, 0)
+	if err != nil {
+		return "", err
 	}
 
-	gsutils.CheckError(downloader.Download(objName, zipPath))
-	defer func() {
-		err = os.Remove(zipPath)
-		if err != nil {
-			log.Println(err)
-		}
-	}()
-	gsutils.CheckError(os.RemoveAll(p))
-	gsutils.CheckError(ziputils.UnzipSource(zipPath, p))
+	appData = filepath.Join(appData, AppName)
+	return appData, os.MkdirAll(appData, 0755)
 }
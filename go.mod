@@ -1,16 +1,34 @@
 module github.com/chenjianlong/gamesave-sync
 
-go 1.16
+go 1.17
 
 require (
 	github.com/alexflint/go-arg v1.4.3
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/jeandeaual/go-locale v0.0.0-20220711133428-7de61946b173
 	github.com/jlaffaye/ftp v0.0.0-20220630165035-11536801d1ff
+	github.com/klauspost/compress v1.13.5
 	github.com/minio/minio-go/v7 v7.0.31
 	github.com/mitchellh/go-ps v1.0.0
 	github.com/nicksnyder/go-i18n/v2 v2.1.1
+	github.com/pmezard/go-difflib v1.0.0
 	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8
 	golang.org/x/text v0.3.4
 	gopkg.in/ini.v1 v1.57.0
 )
+
+require (
+	github.com/alexflint/go-scalar v1.1.0 // indirect
+	github.com/google/uuid v1.1.1 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/json-iterator/go v1.1.12 // indirect
+	github.com/klauspost/cpuid v1.3.1 // indirect
+	github.com/minio/md5-simd v1.1.0 // indirect
+	github.com/minio/sha256-simd v0.1.1 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/rs/xid v1.2.1 // indirect
+	golang.org/x/crypto v0.0.0-20201216223049-8b5274cf687f // indirect
+	golang.org/x/net v0.0.0-20200707034311-ab3426394381 // indirect
+)
@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package gsutils
+
+import (
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// DiskFree returns the free bytes available to the current user on the volume of path.
+func DiskFree(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// Volume returns the ID of the volume of the existing path, the paths on one volume share it.
+func Volume(path string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "", err
+	}
+
+	return strconv.FormatUint(uint64(st.Dev), 10), nil
+}
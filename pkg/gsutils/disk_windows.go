@@ -0,0 +1,31 @@
+package gsutils
+
+import "golang.org/x/sys/windows"
+
+// DiskFree returns the free bytes available to the current user on the volume of path.
+func DiskFree(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var free uint64
+	err = windows.GetDiskFreeSpaceEx(p, &free, nil, nil)
+	return free, err
+}
+
+// Volume returns the ID of the volume of the existing path, the paths on one volume share it.
+// It's the mount point of the volume, such as C:\.
+func Volume(path string) (string, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	if err = windows.GetVolumePathName(p, &buf[0], uint32(len(buf))); err != nil {
+		return "", err
+	}
+
+	return windows.UTF16ToString(buf), nil
+}
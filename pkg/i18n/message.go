@@ -2,7 +2,6 @@ package i18n
 
 import (
 	"encoding/json"
-	. "github.com/chenjianlong/gamesave-sync/pkg/gsutils"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"golang.org/x/text/language"
 	"log"
@@ -11,14 +10,24 @@ import (
 var bundle *i18n.Bundle
 var loc *i18n.Localizer
 
-func InitBundle(locale string) {
+func InitBundle(locale string) error {
 	bundle = i18n.NewBundle(language.English)
 	bundle.RegisterUnmarshalFunc("json", json.Unmarshal)
-	bundle.MustLoadMessageFile("i18n/en.json")
-	bundle.MustLoadMessageFile("i18n/zh-CN.json")
+	for _, path := range []string{"i18n/en.json", "i18n/zh-CN.json"} {
+		if _, err := bundle.LoadMessageFile(path); err != nil {
+			return err
+		}
+	}
+
 	loc = i18n.NewLocalizer(bundle, locale)
+	return nil
 }
 func GetSyncGameMessage(msgID string) string {
+	if loc == nil {
+		// InitBundle isn't called by the embedders of the syncer
+		return msgID
+	}
+
 	name, _, _ := loc.LocalizeWithTag(&i18n.LocalizeConfig{
 		MessageID: msgID,
 	})
@@ -34,8 +43,8 @@ func GetSyncGameMessage(msgID string) string {
 		},
 	})
 	if msg == "" {
-		CheckError(err)
-		log.Fatal("Message with SyncGame ID not found")
+		log.Printf("Message with SyncGame ID not found, err=%v\n", err)
+		msg = name
 	}
 	return msg
 }
@@ -0,0 +1,86 @@
+package syncer
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+)
+
+// scanGameSave walks the game save once, the result is used both to detect changes and to archive it.
+// Components of a game with several save locations are stored under their names.
+func (s *Syncer) scanGameSave(info GameInfo) (*ziputils.Tree, error) {
+	if len(info.Components) == 1 && info.Components[0].Name == "" {
+		return ziputils.Scan(s.fs, info.Components[0].Dir, info.Components[0].Filter)
+	}
+
+	tree := new(ziputils.Tree)
+	for _, component := range info.Components {
+		if !s.isDir(component.Dir) {
+			continue
+		}
+
+		sub, err := ziputils.Scan(s.fs, component.Dir, component.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		tree.Add(component.Name, sub)
+	}
+
+	return tree, nil
+}
+
+// isDir reports whether path is an existing directory.
+func (s *Syncer) isDir(path string) bool {
+	info, err := s.fs.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// archivePath creates a local temporary archive used to transfer objName and returns its path,
+// it's unique so the games synced at the same time never share one.
+func (s *Syncer) archivePath(info GameInfo, objName string) (string, error) {
+	format, _ := ziputils.FormatFromName(objName)
+	return s.fs.TempFile(s.appData, info.Name+"-*."+format.Ext())
+}
+
+func (s *Syncer) uploadGameSave(tree *ziputils.Tree, zipPath, objName string, opts ziputils.Options) error {
+	defer s.removeArchive(zipPath)
+	if err := ziputils.ArchiveTree(s.fs, tree, zipPath, opts); err != nil {
+		return err
+	}
+
+	if err := s.transfer.Upload(zipPath, objName); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully uploaded %s\n", objName)
+	return nil
+}
+
+func (s *Syncer) downloadGameSave(info GameInfo, zipPath, objName string) error {
+	err := s.fs.Remove(zipPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	defer s.removeArchive(zipPath)
+	if err = s.transfer.Download(objName, zipPath); err != nil {
+		return err
+	}
+
+	if err = s.restoreGameSave(info, zipPath); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully restored %s\n", objName)
+	return nil
+}
+
+// removeArchive removes a temporary archive, a failure is only logged.
+func (s *Syncer) removeArchive(zipPath string) {
+	if err := s.fs.Remove(zipPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,161 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/gsutils"
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+)
+
+// BackupPolicy bounds the local backups kept of each game, the newest backup is always kept.
+type BackupPolicy struct {
+	MaxCount int
+	MaxSize  int64
+}
+
+var DefaultBackupPolicy = BackupPolicy{MaxCount: 10, MaxSize: 4 << 30}
+
+func getBackupDir(appData, game string) string {
+	return filepath.Join(appData, "backups", game)
+}
+
+// backupGameSave archives the local game save into the backup directory of the game before it's
+// overwritten by a download, then removes the oldest backups beyond the policy.
+func (s *Syncer) backupGameSave(info GameInfo) error {
+	tree, err := s.scanGameSave(info)
+	if err != nil {
+		return err
+	}
+
+	if tree.ModTime() == nil {
+		return nil
+	}
+
+	dir := getBackupDir(s.appData, info.Name)
+	if err := s.fs.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	backupPath, err := s.backupPath(dir, info.Archive.Format)
+	if err != nil {
+		return err
+	}
+
+	if err := ziputils.ArchiveTree(s.fs, tree, backupPath, info.Archive); err != nil {
+		s.removeArchive(backupPath)
+		return err
+	}
+
+	log.Printf("Backed up %s to %s\n", info.Name, backupPath)
+	return s.rotateBackups(dir)
+}
+
+// backupPath returns the path of a new backup in dir, named by the backup time to the nanosecond
+// so the names sort by time and two backups in the same second don't overwrite each other.
+func (s *Syncer) backupPath(dir string, format ziputils.Format) (string, error) {
+	now := s.clock.Now().UTC()
+	for {
+		name := fmt.Sprintf("%s_%09d.%s", now.Format(gsutils.TimeFormat), now.Nanosecond(), format.Ext())
+		path := filepath.Join(dir, name)
+		_, err := s.fs.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return path, nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		now = now.Add(time.Nanosecond)
+	}
+}
+
+// listBackups returns the backups in dir, oldest first.
+func (s *Syncer) listBackups(dir string) ([]os.FileInfo, error) {
+	files, err := s.fs.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var backups []os.FileInfo
+	for _, file := range files {
+		if _, ok := ziputils.TrimExt(file.Name()); ok && file.Mode().IsRegular() {
+			backups = append(backups, file)
+		}
+	}
+
+	// The names start with the backup time
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name() < backups[j].Name()
+	})
+
+	return backups, nil
+}
+
+func (s *Syncer) rotateBackups(dir string) error {
+	backups, err := s.listBackups(dir)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, backup := range backups {
+		size += backup.Size()
+	}
+
+	for len(backups) > 1 && (len(backups) > s.backup.MaxCount || size > s.backup.MaxSize) {
+		if err = s.fs.Remove(filepath.Join(dir, backups[0].Name())); err != nil {
+			return err
+		}
+
+		size -= backups[0].Size()
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// UndoDownload puts back the game save as it was before the last download, the backup is
+// removed afterwards, so undoing again goes back one more download. The game save put back is
+// recorded as in sync with the downloaded snapshot, so it's neither uploaded nor replaced by it
+// until either side changes.
+func (s *Syncer) UndoDownload(info GameInfo) error {
+	dir := getBackupDir(s.appData, info.Name)
+	backups, err := s.listBackups(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(backups) == 0 {
+		return fmt.Errorf("no backup of %s", info.Name)
+	}
+
+	backupPath := filepath.Join(dir, backups[len(backups)-1].Name())
+	if err = s.restoreGameSave(info, backupPath); err != nil {
+		return err
+	}
+
+	saveTime, hash, err := s.localGameSave(info)
+	if err != nil {
+		return err
+	}
+
+	if err = s.state.update(info.Name, func(g *gameState) {
+		g.SaveTime, g.Hash = saveTime, hash
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully restored %s from %s\n", info.Name, backupPath)
+	return s.fs.Remove(backupPath)
+}
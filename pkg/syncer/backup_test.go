@@ -0,0 +1,102 @@
+package syncer
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestBackupGameSaveInSameSecond(t *testing.T) {
+	root := t.TempDir()
+	s, err := New(Options{
+		AppData: root,
+		Clock:   fixedClock(time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC)),
+		Backup:  DefaultBackupPolicy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := GameInfo{
+		Name:       "Game",
+		Components: []Component{{Dir: filepath.Join(root, "save")}},
+		Archive:    ziputils.Options{Format: ziputils.FormatZip},
+	}
+
+	writeFile(t, filepath.Join(root, "save", "save.sav"), "first")
+	if err = s.backupGameSave(info); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(root, "save", "save.sav"), "second")
+	if err = s.backupGameSave(info); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := s.listBackups(getBackupDir(root, info.Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backups) != 2 {
+		t.Fatalf("got %d backups, want 2", len(backups))
+	}
+
+	// The newest backup is put back first.
+	if err = s.UndoDownload(info); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := s.scanGameSave(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := tree.Entries[0].Size; got != int64(len("second")) {
+		t.Errorf("undone game save has size %d, want the second backup", got)
+	}
+}
+
+// The game save put back by undo stays until it changes, then it's uploaded.
+func TestUndoDownload(t *testing.T) {
+	fs := newMemFS()
+	tr := newMemTransfer(fs)
+	a := newFakeDevice(t, fs, tr, "a", Options{})
+	b := newFakeDevice(t, fs, tr, "b", Options{})
+	fs.writeFile(t, a.savePath("save.sav"), "one")
+	a.sync(t, outcomeUploaded)
+	b.sync(t, outcomeDownloaded)
+	fs.writeFile(t, a.savePath("save.sav"), "two")
+	a.sync(t, outcomeUploaded)
+	b.sync(t, outcomeDownloaded)
+
+	if err := b.UndoDownload(b.info); err != nil {
+		t.Fatal(err)
+	}
+
+	path := b.savePath("save.sav")
+	if got := fs.readFile(t, path); got != "one" {
+		t.Fatalf("save.sav after undo = %q, want %q", got, "one")
+	}
+
+	b.sync(t, outcomeInSync)
+	if got := fs.readFile(t, path); got != "one" {
+		t.Errorf("save.sav after a sync = %q, want %q", got, "one")
+	}
+
+	if got, want := snapshotContents(t, b), []string{"one", "two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshots = %q, want %q", got, want)
+	}
+
+	fs.writeFile(t, path, "three")
+	b.sync(t, outcomeUploaded)
+}
@@ -0,0 +1,210 @@
+package syncer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// maxTextDiffSize is the size of the largest file shown as a text diff.
+const maxTextDiffSize = 1 << 20
+
+// diffSide is one of the game saves compared, the local one or an extracted snapshot.
+type diffSide struct {
+	fs      FS
+	name    string
+	tree    *ziputils.Tree
+	entries map[string]int
+}
+
+func newDiffSide(fs FS, name string, tree *ziputils.Tree, cache *ziputils.HashCache) (*diffSide, error) {
+	if _, err := tree.Hash(fs, cache); err != nil {
+		return nil, err
+	}
+
+	side := &diffSide{fs: fs, name: name, tree: tree, entries: map[string]int{}}
+	for i, entry := range tree.Entries {
+		side.entries[entry.Path] = i
+	}
+
+	return side, nil
+}
+
+func (d *diffSide) entry(name string) *ziputils.ManifestEntry {
+	i, ok := d.entries[name]
+	if !ok {
+		return nil
+	}
+
+	return &d.tree.Entries[i]
+}
+
+func (d *diffSide) read(name string) ([]byte, error) {
+	return d.fs.ReadFile(d.tree.LocalPath(d.entries[name]))
+}
+
+// extractSnapshot downloads the snapshot of the game and extracts it into a new directory under
+// the app data directory, the caller removes the directory.
+func (s *Syncer) extractSnapshot(info GameInfo, snap snapshot) (string, *ziputils.Tree, error) {
+	dir, err := s.fs.TempDir(s.appData, "diff-*")
+	if err != nil {
+		return "", nil, err
+	}
+
+	archivePath := filepath.Join(dir, "snapshot."+snap.Format.Ext())
+	if err = s.transfer.Download(snap.Name, archivePath); err != nil {
+		return dir, nil, err
+	}
+
+	saveDir := filepath.Join(dir, "save")
+	if err = ziputils.Extract(s.fs, archivePath, saveDir, s.limits); err != nil {
+		return dir, nil, err
+	}
+
+	tree, err := ziputils.Scan(s.fs, saveDir, nil)
+	return dir, tree, err
+}
+
+// DiffSnapshots prints the changes from the game save from to the game save to. Each of them is a
+// snapshot ref, or the local game save if it's empty. Modified text files are shown as unified
+// diffs if text is true.
+func (s *Syncer) DiffSnapshots(w io.Writer, info GameInfo, from, to string, text bool) error {
+	snapshots, err := listSnapshots(s.transfer, info.Name)
+	if err != nil {
+		return err
+	}
+
+	var sides []*diffSide
+	for _, ref := range []string{from, to} {
+		if ref == "" {
+			tree, err := s.scanGameSave(info)
+			if err != nil {
+				return err
+			}
+
+			side, err := newDiffSide(s.fs, "local", tree, s.hashes)
+			if err != nil {
+				return err
+			}
+
+			sides = append(sides, side)
+			continue
+		}
+
+		snap, err := findSnapshotRef(snapshots, ref)
+		if err != nil {
+			return err
+		}
+
+		dir, tree, err := s.extractSnapshot(info, snap)
+		if dir != "" {
+			defer s.fs.RemoveAll(dir)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		side, err := newDiffSide(s.fs, snap.Name, tree, nil)
+		if err != nil {
+			return err
+		}
+
+		sides = append(sides, side)
+	}
+
+	return printDiff(w, sides[0], sides[1], text)
+}
+
+func printDiff(w io.Writer, old, new *diffSide, text bool) error {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", old.name, new.name)
+	var names []string
+	for name := range old.entries {
+		names = append(names, name)
+	}
+
+	for name := range new.entries {
+		if _, ok := old.entries[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	changed := false
+	for _, name := range names {
+		oldEntry, newEntry := old.entry(name), new.entry(name)
+		switch {
+		case oldEntry == nil:
+			fmt.Fprintf(w, "A  %s  %s\n", name, describeEntry(newEntry))
+		case newEntry == nil:
+			fmt.Fprintf(w, "D  %s  %s\n", name, describeEntry(oldEntry))
+		case oldEntry.Dir != newEntry.Dir || oldEntry.SHA256 != newEntry.SHA256:
+			fmt.Fprintf(w, "M  %s  %s -> %s\n", name, describeEntry(oldEntry), describeEntry(newEntry))
+			if text && !oldEntry.Dir && !newEntry.Dir {
+				if err := printTextDiff(w, old, new, name); err != nil {
+					return err
+				}
+			}
+		default:
+			continue
+		}
+
+		changed = true
+	}
+
+	if !changed {
+		fmt.Fprintln(w, "No changes")
+	}
+
+	return nil
+}
+
+func describeEntry(entry *ziputils.ManifestEntry) string {
+	modTime := time.Unix(0, entry.ModTime).Format("2006-01-02 15:04:05")
+	if entry.Dir {
+		return "directory, " + modTime
+	}
+
+	return formatSize(entry.Size) + ", " + modTime
+}
+
+// printTextDiff prints the unified diff of a file, unless either side of it isn't text.
+func printTextDiff(w io.Writer, old, new *diffSide, name string) error {
+	if old.entry(name).Size > maxTextDiffSize || new.entry(name).Size > maxTextDiffSize {
+		return nil
+	}
+
+	oldContent, err := old.read(name)
+	if err != nil {
+		return err
+	}
+
+	newContent, err := new.read(name)
+	if err != nil {
+		return err
+	}
+
+	if !isText(oldContent) || !isText(newContent) {
+		return nil
+	}
+
+	return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(oldContent)),
+		B:        difflib.SplitLines(string(newContent)),
+		FromFile: old.name + "/" + name,
+		ToFile:   new.name + "/" + name,
+		Context:  3,
+	})
+}
+
+// isText reports whether the content looks like text, such as ini, json or xml files.
+func isText(content []byte) bool {
+	return utf8.Valid(content) && !bytes.ContainsRune(content, 0)
+}
@@ -0,0 +1,59 @@
+package syncer
+
+import "fmt"
+
+// Direction is which way the game save of a game is synced on this device.
+type Direction string
+
+const (
+	// Bidirectional uploads the local changes and downloads the remote changes.
+	Bidirectional Direction = "bidirectional"
+	// PushOnly makes this device the source of truth, the local game save is uploaded whenever it
+	// differs from the latest snapshot and it's never replaced.
+	PushOnly Direction = "push-only"
+	// PullOnly never uploads, a game save changed on both sides is left as a conflict, which is
+	// only resolved by keeping the remote one.
+	PullOnly Direction = "pull-only"
+	// BackupOnly uploads the local changes and never downloads, the snapshots are only restored
+	// on demand.
+	BackupOnly Direction = "backup-only"
+)
+
+// ParseDirection returns the direction named name, empty means Bidirectional.
+func ParseDirection(name string) (Direction, error) {
+	switch d := Direction(name); d {
+	case "":
+		return Bidirectional, nil
+	case Bidirectional, PushOnly, PullOnly, BackupOnly:
+		return d, nil
+	default:
+		return "", fmt.Errorf("invalid direction %s, expect %s, %s, %s or %s", name, Bidirectional, PushOnly, PullOnly,
+			BackupOnly)
+	}
+}
+
+// uploads reports whether the game save is ever uploaded.
+func (d Direction) uploads() bool {
+	return d != PullOnly
+}
+
+// restrict turns the action planned for a bidirectional sync into the action of the direction,
+// hasLocal tells whether there is a local game save.
+func (d Direction) restrict(action syncAction, reason string, hasLocal bool) (syncAction, string) {
+	switch {
+	case d == PushOnly && (action == actionDownload || action == actionConflict):
+		if !hasLocal {
+			return actionSkip, fmt.Sprintf("%s, %s never downloads", reason, d)
+		}
+
+		return actionUpload, fmt.Sprintf("%s, %s uploads the local game save", reason, d)
+	case d == PullOnly && action == actionUpload:
+		return actionSkip, fmt.Sprintf("%s, %s never uploads", reason, d)
+	case d == BackupOnly && action == actionDownload:
+		return actionSkip, fmt.Sprintf("%s, %s never downloads", reason, d)
+	case d == BackupOnly && action == actionConflict:
+		return actionUpload, fmt.Sprintf("%s, %s uploads the local game save", reason, d)
+	default:
+		return action, reason
+	}
+}
@@ -0,0 +1,146 @@
+package syncer
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseDirection(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Direction
+		wantErr bool
+	}{
+		{"", Bidirectional, false},
+		{"bidirectional", Bidirectional, false},
+		{"push-only", PushOnly, false},
+		{"pull-only", PullOnly, false},
+		{"backup-only", BackupOnly, false},
+		{"push", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseDirection(test.name)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("ParseDirection(%q) = %q, %v, want %q, error %v", test.name, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestDirectionRestrict(t *testing.T) {
+	tests := []struct {
+		direction Direction
+		action    syncAction
+		hasLocal  bool
+		want      syncAction
+	}{
+		{Bidirectional, actionUpload, true, actionUpload},
+		{Bidirectional, actionDownload, true, actionDownload},
+		{Bidirectional, actionConflict, true, actionConflict},
+		{PushOnly, actionUpload, true, actionUpload},
+		{PushOnly, actionDownload, true, actionUpload},
+		{PushOnly, actionDownload, false, actionSkip},
+		{PushOnly, actionConflict, true, actionUpload},
+		{PushOnly, actionNone, true, actionNone},
+		{PullOnly, actionUpload, true, actionSkip},
+		{PullOnly, actionDownload, true, actionDownload},
+		{PullOnly, actionConflict, true, actionConflict},
+		{BackupOnly, actionUpload, true, actionUpload},
+		{BackupOnly, actionDownload, true, actionSkip},
+		{BackupOnly, actionDownload, false, actionSkip},
+		{BackupOnly, actionConflict, true, actionUpload},
+	}
+
+	for _, test := range tests {
+		got, reason := test.direction.restrict(test.action, "reason", test.hasLocal)
+		if got != test.want {
+			t.Errorf("%s.restrict(%s, hasLocal=%v) = %s (%s), want %s", test.direction, test.action, test.hasLocal,
+				got, reason, test.want)
+		}
+	}
+}
+
+func TestSyncGameDirection(t *testing.T) {
+	changes := map[string]func(t *testing.T, fs *memFS, a, b *fakeDevice){
+		"local": func(t *testing.T, fs *memFS, a, b *fakeDevice) {
+			fs.writeFile(t, b.savePath("save.sav"), "b")
+		},
+		"remote": func(t *testing.T, fs *memFS, a, b *fakeDevice) {
+			fs.writeFile(t, a.savePath("save.sav"), "a")
+			a.sync(t, outcomeUploaded)
+		},
+		"both": func(t *testing.T, fs *memFS, a, b *fakeDevice) {
+			fs.writeFile(t, a.savePath("save.sav"), "a")
+			a.sync(t, outcomeUploaded)
+			fs.writeFile(t, b.savePath("save.sav"), "b")
+		},
+	}
+
+	tests := []struct {
+		direction Direction
+		change    string
+		want      syncOutcome
+		wantSave  string
+		latest    string
+	}{
+		{Bidirectional, "local", outcomeUploaded, "b", "b"},
+		{Bidirectional, "remote", outcomeDownloaded, "a", "a"},
+		{Bidirectional, "both", outcomeConflict, "b", "a"},
+		{PushOnly, "local", outcomeUploaded, "b", "b"},
+		{PushOnly, "remote", outcomeUploaded, "one", "one"},
+		{PushOnly, "both", outcomeUploaded, "b", "b"},
+		{PullOnly, "local", outcomeSkipped, "b", "one"},
+		{PullOnly, "remote", outcomeDownloaded, "a", "a"},
+		{PullOnly, "both", outcomeConflict, "b", "a"},
+		{BackupOnly, "local", outcomeUploaded, "b", "b"},
+		{BackupOnly, "remote", outcomeSkipped, "one", "a"},
+		{BackupOnly, "both", outcomeUploaded, "b", "b"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s/%s", test.direction, test.change), func(t *testing.T) {
+			fs := newMemFS()
+			tr := newMemTransfer(fs)
+			a := newFakeDevice(t, fs, tr, "a", Options{})
+			b := newFakeDevice(t, fs, tr, "b", Options{})
+			fs.writeFile(t, a.savePath("save.sav"), "one")
+			a.sync(t, outcomeUploaded)
+			b.sync(t, outcomeDownloaded)
+			b.info.Direction = test.direction
+
+			changes[test.change](t, fs, a, b)
+			b.sync(t, test.want)
+			if got := fs.readFile(t, b.savePath("save.sav")); got != test.wantSave {
+				t.Errorf("save.sav = %q, want %q", got, test.wantSave)
+			}
+
+			contents := snapshotContents(t, b)
+			if got := contents[len(contents)-1]; got != test.latest {
+				t.Errorf("latest snapshot = %q, want %q", got, test.latest)
+			}
+		})
+	}
+}
+
+// A pull-only device resolves a conflict only by keeping the remote game save.
+func TestResolveConflictPullOnly(t *testing.T) {
+	_, b := newConflict(t, false)
+	b.info.Direction = PullOnly
+	for _, choice := range []ResolveChoice{KeepLocal, KeepBoth} {
+		if err := b.ResolveConflict(b.info, choice); err == nil {
+			t.Errorf("ResolveConflict(%s) = nil, want an error", choice)
+		}
+	}
+
+	if got := snapshotContents(t, b); len(got) != 2 {
+		t.Errorf("snapshots = %q, want nothing uploaded", got)
+	}
+
+	if err := b.ResolveConflict(b.info, KeepRemote); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.fs.readFile(t, b.savePath("save.sav")); got != "a" {
+		t.Errorf("save.sav = %q, want %q", got, "a")
+	}
+}
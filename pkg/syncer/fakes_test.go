@@ -0,0 +1,747 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/transfer"
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+)
+
+// memRoot is the root directory of a memFS.
+var memRoot = filepath.Join(string(filepath.Separator), "mem")
+
+type memNode struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// memFS is an FS kept in memory. Every change moves its clock a second forward, so the files
+// written one after another have different modification times.
+type memFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode
+	now   time.Time
+	seq   int
+	free  uint64
+	// watches receives the watchers returned by Watch, the tests send their changes.
+	watches chan *memWatcher
+}
+
+func newMemFS() *memFS {
+	fs := &memFS{
+		nodes:   map[string]*memNode{},
+		now:     time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		free:    1 << 40,
+		watches: make(chan *memWatcher, 1),
+	}
+
+	for dir := memRoot; ; dir = filepath.Dir(dir) {
+		fs.nodes[dir] = &memNode{mode: os.ModeDir | 0755, modTime: fs.now}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	return fs
+}
+
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+// tick moves the clock forward and returns it, fs.mu is held.
+func (fs *memFS) tick() time.Time {
+	fs.now = fs.now.Add(time.Second)
+	return fs.now
+}
+
+// checkParent fails unless the parent of name is a directory, fs.mu is held.
+func (fs *memFS) checkParent(op, name string) error {
+	if parent, ok := fs.nodes[filepath.Dir(name)]; !ok || !parent.mode.IsDir() {
+		return notExist(op, name)
+	}
+
+	return nil
+}
+
+// children returns the sorted names of the files in dir, fs.mu is held.
+func (fs *memFS) children(dir string) []string {
+	var names []string
+	for name := range fs.nodes {
+		if name != dir && filepath.Dir(name) == dir {
+			names = append(names, filepath.Base(name))
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// isUnder reports whether name is dir or in it.
+func isUnder(name, dir string) bool {
+	return name == dir || strings.HasPrefix(name, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func (fs *memFS) Open(name string) (ziputils.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *memFS) OpenFile(name string, flag int, perm os.FileMode) (ziputils.File, error) {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	node, ok := fs.nodes[name]
+	if !ok {
+		if flag&os.O_CREATE == 0 {
+			return nil, notExist("open", name)
+		}
+
+		if err := fs.checkParent("open", name); err != nil {
+			return nil, err
+		}
+
+		node = &memNode{mode: perm, modTime: fs.tick()}
+		fs.nodes[name] = node
+	}
+
+	if flag&os.O_TRUNC != 0 {
+		node.data = nil
+	}
+
+	return &memFile{fs: fs, name: name, node: node, writable: flag&(os.O_WRONLY|os.O_RDWR) != 0}, nil
+}
+
+func (fs *memFS) Stat(name string) (os.FileInfo, error) {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	node, ok := fs.nodes[name]
+	if !ok {
+		return nil, notExist("stat", name)
+	}
+
+	return memFileInfo{name: filepath.Base(name), node: *node}, nil
+}
+
+func (fs *memFS) Walk(root string, fn filepath.WalkFunc) error {
+	info, err := fs.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = fs.walk(root, info, fn)
+	}
+
+	if err == filepath.SkipDir {
+		return nil
+	}
+
+	return err
+}
+
+func (fs *memFS) walk(path string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	fs.mu.Lock()
+	names := fs.children(path)
+	fs.mu.Unlock()
+	if err := fn(path, info, nil); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		child := filepath.Join(path, name)
+		info, err := fs.Stat(child)
+		if err != nil {
+			if err = fn(child, nil, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+
+			continue
+		}
+
+		if err = fs.walk(child, info, fn); err != nil && (err != filepath.SkipDir || !info.IsDir()) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (fs *memFS) MkdirAll(path string, perm os.FileMode) error {
+	path = filepath.Clean(path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var dirs []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if node, ok := fs.nodes[dir]; ok {
+			if !node.mode.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: dir, Err: errors.New("not a directory")}
+			}
+
+			break
+		}
+
+		dirs = append(dirs, dir)
+	}
+
+	for _, dir := range dirs {
+		fs.nodes[dir] = &memNode{mode: os.ModeDir | perm, modTime: fs.tick()}
+	}
+
+	return nil
+}
+
+func (fs *memFS) Chmod(name string, mode os.FileMode) error {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	node, ok := fs.nodes[name]
+	if !ok {
+		return notExist("chmod", name)
+	}
+
+	node.mode = node.mode&os.ModeType | mode.Perm()
+	return nil
+}
+
+func (fs *memFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	node, ok := fs.nodes[name]
+	if !ok {
+		return notExist("chtimes", name)
+	}
+
+	node.modTime = mtime
+	return nil
+}
+
+func (fs *memFS) ReadFile(name string) ([]byte, error) {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	node, ok := fs.nodes[name]
+	if !ok {
+		return nil, notExist("open", name)
+	}
+
+	if node.mode.IsDir() {
+		return nil, &os.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+
+	return append([]byte(nil), node.data...), nil
+}
+
+func (fs *memFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.checkParent("open", name); err != nil {
+		return err
+	}
+
+	if node, ok := fs.nodes[name]; ok && node.mode.IsDir() {
+		return &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+
+	fs.nodes[name] = &memNode{data: append([]byte(nil), data...), mode: perm, modTime: fs.tick()}
+	return nil
+}
+
+func (fs *memFS) ReadDir(name string) ([]os.FileInfo, error) {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if node, ok := fs.nodes[name]; !ok || !node.mode.IsDir() {
+		return nil, notExist("open", name)
+	}
+
+	var infos []os.FileInfo
+	for _, child := range fs.children(name) {
+		infos = append(infos, memFileInfo{name: child, node: *fs.nodes[filepath.Join(name, child)]})
+	}
+
+	return infos, nil
+}
+
+func (fs *memFS) Rename(oldpath, newpath string) error {
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	node, ok := fs.nodes[oldpath]
+	if !ok {
+		return notExist("rename", oldpath)
+	}
+
+	if err := fs.checkParent("rename", newpath); err != nil {
+		return err
+	}
+
+	if newpath == oldpath {
+		return nil
+	}
+
+	if isUnder(newpath, oldpath) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errors.New("invalid argument")}
+	}
+
+	if dst, ok := fs.nodes[newpath]; ok {
+		if dst.mode.IsDir() != node.mode.IsDir() || len(fs.children(newpath)) != 0 {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errors.New("file exists")}
+		}
+	}
+
+	moved := map[string]*memNode{}
+	for name, n := range fs.nodes {
+		if isUnder(name, oldpath) {
+			moved[newpath+strings.TrimPrefix(name, oldpath)] = n
+			delete(fs.nodes, name)
+		}
+	}
+
+	for name, n := range moved {
+		fs.nodes[name] = n
+	}
+
+	return nil
+}
+
+func (fs *memFS) Remove(name string) error {
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.nodes[name]; !ok {
+		return notExist("remove", name)
+	}
+
+	if len(fs.children(name)) != 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+	}
+
+	delete(fs.nodes, name)
+	return nil
+}
+
+func (fs *memFS) RemoveAll(path string) error {
+	path = filepath.Clean(path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for name := range fs.nodes {
+		if isUnder(name, path) {
+			delete(fs.nodes, name)
+		}
+	}
+
+	return nil
+}
+
+// tempName returns a new name in dir for the pattern of ioutil.TempFile, fs.mu is held.
+func (fs *memFS) tempName(dir, pattern string) string {
+	fs.seq++
+	seq := strconv.Itoa(fs.seq)
+	if strings.Contains(pattern, "*") {
+		return filepath.Join(dir, strings.Replace(pattern, "*", seq, 1))
+	}
+
+	return filepath.Join(dir, pattern+seq)
+}
+
+func (fs *memFS) TempFile(dir, pattern string) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	name := fs.tempName(filepath.Clean(dir), pattern)
+	if err := fs.checkParent("open", name); err != nil {
+		return "", err
+	}
+
+	fs.nodes[name] = &memNode{mode: 0600, modTime: fs.tick()}
+	return name, nil
+}
+
+func (fs *memFS) TempDir(dir, pattern string) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	name := fs.tempName(filepath.Clean(dir), pattern)
+	if err := fs.checkParent("mkdir", name); err != nil {
+		return "", err
+	}
+
+	fs.nodes[name] = &memNode{mode: os.ModeDir | 0700, modTime: fs.tick()}
+	return name, nil
+}
+
+func (fs *memFS) DiskFree(path string) (uint64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.free, nil
+}
+
+func (fs *memFS) Volume(path string) (string, error) {
+	if _, err := fs.Stat(path); err != nil {
+		return "", err
+	}
+
+	return memRoot, nil
+}
+
+func (fs *memFS) Watch() (Watcher, error) {
+	w := &memWatcher{changes: make(chan string), errors: make(chan error)}
+	fs.watches <- w
+	return w, nil
+}
+
+// writeFile writes the file in fs with its parent directories.
+func (fs *memFS) writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns the content of the file in fs.
+func (fs *memFS) readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := fs.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+type memFileInfo struct {
+	name string
+	node memNode
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return int64(len(fi.node.data)) }
+func (fi memFileInfo) Mode() os.FileMode  { return fi.node.mode }
+func (fi memFileInfo) ModTime() time.Time { return fi.node.modTime }
+func (fi memFileInfo) IsDir() bool        { return fi.node.mode.IsDir() }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+// memFile is an open file of a memFS.
+type memFile struct {
+	fs       *memFS
+	name     string
+	node     *memNode
+	offset   int64
+	writable bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.node.mode.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if !f.writable {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: errors.New("bad file descriptor")}
+	}
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.node.data = append(f.node.data[:f.offset], p...)
+	f.node.modTime = f.fs.tick()
+	f.offset += int64(len(p))
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return memFileInfo{name: filepath.Base(f.name), node: *f.node}, nil
+}
+
+// memWatcher is the Watcher of a memFS, it only reports the changes sent by the test.
+type memWatcher struct {
+	mu      sync.Mutex
+	calls   []string
+	closed  bool
+	changes chan string
+	errors  chan error
+}
+
+func (w *memWatcher) Add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls = append(w.calls, "add "+dir)
+	return nil
+}
+
+func (w *memWatcher) Remove(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls = append(w.calls, "remove "+dir)
+	return nil
+}
+
+func (w *memWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+func (w *memWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+func (w *memWatcher) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		close(w.changes)
+		close(w.errors)
+		w.closed = true
+	}
+
+	return nil
+}
+
+// memTransfer is a remote storage kept in memory, the local files are the ones of its memFS.
+type memTransfer struct {
+	fs      *memFS
+	mu      sync.Mutex
+	objects map[string][]byte
+	// serverTime is the time of the server, the current time if it's zero
+	serverTime time.Time
+}
+
+func newMemTransfer(fs *memFS) *memTransfer {
+	return &memTransfer{fs: fs, objects: map[string][]byte{}}
+}
+
+func (t *memTransfer) Upload(localFile, remoteFile string) error {
+	content, err := t.fs.ReadFile(localFile)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.objects[remoteFile] = content
+	return nil
+}
+
+func (t *memTransfer) Download(remoteFile, localFile string) error {
+	t.mu.Lock()
+	content, ok := t.objects[remoteFile]
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%s is not found", remoteFile)
+	}
+
+	return t.fs.WriteFile(localFile, content, 0644)
+}
+
+func (t *memTransfer) ListFileInfo(dir string) chan transfer.FileInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var names []string
+	for name := range t.objects {
+		if strings.HasPrefix(name, dir) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	ch := make(chan transfer.FileInfo, len(names))
+	for _, name := range names {
+		ch <- transfer.FileInfo{Name: name, Size: int64(len(t.objects[name]))}
+	}
+
+	close(ch)
+	return ch
+}
+
+func (t *memTransfer) Remove(remoteFile string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.objects[remoteFile]; !ok {
+		return fmt.Errorf("%s is not found", remoteFile)
+	}
+
+	delete(t.objects, remoteFile)
+	return nil
+}
+
+func (t *memTransfer) Rename(src, dst string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	content, ok := t.objects[src]
+	if !ok {
+		return fmt.Errorf("%s is not found", src)
+	}
+
+	delete(t.objects, src)
+	t.objects[dst] = content
+	return nil
+}
+
+func (t *memTransfer) ServerTime() (time.Time, error) {
+	if t.serverTime.IsZero() {
+		return time.Now(), nil
+	}
+
+	return t.serverTime, nil
+}
+
+// fakeProcesses tells whether the game is running as set by the test.
+type fakeProcesses struct {
+	mu      sync.Mutex
+	running bool
+	calls   int
+}
+
+func (p *fakeProcesses) Running(executable string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	return p.running, nil
+}
+
+func (p *fakeProcesses) setRunning(running bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = running
+}
+
+// fakeDevice is a device syncing the game save in its own directories of a shared memFS
+// with a shared memTransfer.
+type fakeDevice struct {
+	*Syncer
+	fs        *memFS
+	processes *fakeProcesses
+	info      GameInfo
+}
+
+func newFakeDevice(t *testing.T, fs *memFS, tr *memTransfer, name string, opts Options) *fakeDevice {
+	t.Helper()
+	d := &fakeDevice{fs: fs, processes: &fakeProcesses{}}
+	opts.Transfer, opts.FS, opts.Processes = tr, fs, d.processes
+	opts.Clock = fixedClock(time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC))
+	opts.AppData = filepath.Join(memRoot, name, "appdata")
+	opts.Limits, opts.Backup, opts.Hostname = ziputils.DefaultLimits, DefaultBackupPolicy, name
+	if err := fs.MkdirAll(opts.AppData, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	if d.Syncer, err = New(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	d.info = GameInfo{
+		Name:       "Game",
+		Components: []Component{{Dir: filepath.Join(memRoot, name, "save")}},
+		ProcName:   "game.exe",
+		Archive:    ziputils.Options{Format: ziputils.FormatZip},
+		Enabled:    true,
+	}
+	if err = fs.MkdirAll(d.info.Components[0].Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+// savePath returns the path of the file in the game save of the device.
+func (d *fakeDevice) savePath(name string) string {
+	return filepath.Join(d.info.Components[0].Dir, name)
+}
+
+// sync syncs the game and fails unless its outcome is want.
+func (d *fakeDevice) sync(t *testing.T, want syncOutcome) {
+	t.Helper()
+	if err := d.SyncGame(d.info); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := d.state.get(d.info.Name).Outcome; got != want {
+		t.Fatalf("SyncGame() outcome = %s, want %s", got, want)
+	}
+}
+
+// snapshotContents returns the content of save.sav in every snapshot of the game in order,
+// with a trailing "!" for the conflict snapshots.
+func snapshotContents(t *testing.T, d *fakeDevice) []string {
+	t.Helper()
+	snapshots, err := listSnapshots(d.transfer, d.info.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var contents []string
+	for _, snap := range snapshots {
+		dir, err := d.fs.TempDir(d.appData, "snapshot-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		archivePath := filepath.Join(dir, "snapshot.zip")
+		if err = d.transfer.Download(snap.Name, archivePath); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = ziputils.Extract(d.fs, archivePath, filepath.Join(dir, "save"), ziputils.DefaultLimits); err != nil {
+			t.Fatal(err)
+		}
+
+		content := d.fs.readFile(t, filepath.Join(dir, "save", "save.sav"))
+		if snap.Conflict {
+			content += "!"
+		}
+
+		contents = append(contents, content)
+		if err = d.fs.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return contents
+}
@@ -0,0 +1,157 @@
+package syncer
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/gsutils"
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+	"github.com/fsnotify/fsnotify"
+)
+
+// FS is the local filesystem of the game saves, the archives, the sync state, the hash cache,
+// the backups and the restore journals. Every file the syncer touches is reached through it.
+type FS interface {
+	ziputils.FS
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	ReadDir(name string) ([]os.FileInfo, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	// TempFile creates a new empty file in dir and returns its name, see ioutil.TempFile.
+	TempFile(dir, pattern string) (string, error)
+	// TempDir creates a new directory in dir and returns its name, see ioutil.TempDir.
+	TempDir(dir, pattern string) (string, error)
+	// DiskFree returns the free bytes available to the current user on the volume of path.
+	DiskFree(path string) (uint64, error)
+	// Volume returns the ID of the volume of the existing path, the paths on one volume share it.
+	Volume(path string) (string, error)
+	// Watch returns a watcher of the files changed in the directories added to it.
+	Watch() (Watcher, error)
+}
+
+// Watcher reports the files written or created in the watched directories.
+type Watcher interface {
+	Add(dir string) error
+	Remove(dir string) error
+	// Changes receives the paths of the changed files, it's closed with the watcher.
+	Changes() <-chan string
+	// Errors receives the errors of watching, it's closed with the watcher.
+	Errors() <-chan error
+	Close() error
+}
+
+// writeFileAtomic writes the file through a temporary file renamed over it, so it's never half written.
+func writeFileAtomic(fs FS, path string, content []byte) error {
+	tmpPath := path + ".tmp"
+	if err := fs.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+
+	return fs.Rename(tmpPath, path)
+}
+
+// OSFS is the FS of the operating system.
+type OSFS struct {
+	ziputils.OSFS
+}
+
+func (OSFS) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (OSFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return ioutil.WriteFile(name, data, perm)
+}
+
+func (OSFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+func (OSFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (OSFS) TempFile(dir, pattern string) (string, error) {
+	file, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+
+	return file.Name(), file.Close()
+}
+
+func (OSFS) TempDir(dir, pattern string) (string, error) {
+	return ioutil.TempDir(dir, pattern)
+}
+
+func (OSFS) DiskFree(path string) (uint64, error) {
+	return gsutils.DiskFree(path)
+}
+
+func (OSFS) Volume(path string) (string, error) {
+	return gsutils.Volume(path)
+}
+
+func (OSFS) Watch() (Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &fsnotifyWatcher{watcher: watcher, changes: make(chan string), done: make(chan struct{})}
+	go w.run()
+	return w, nil
+}
+
+// fsnotifyWatcher is the Watcher of the operating system.
+type fsnotifyWatcher struct {
+	watcher *fsnotify.Watcher
+	changes chan string
+	done    chan struct{}
+}
+
+func (w *fsnotifyWatcher) run() {
+	defer close(w.changes)
+	for event := range w.watcher.Events {
+		if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+			continue
+		}
+
+		select {
+		case w.changes <- event.Name:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *fsnotifyWatcher) Add(dir string) error {
+	return w.watcher.Add(dir)
+}
+
+func (w *fsnotifyWatcher) Remove(dir string) error {
+	return w.watcher.Remove(dir)
+}
+
+func (w *fsnotifyWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+func (w *fsnotifyWatcher) Errors() <-chan error {
+	return w.watcher.Errors
+}
+
+func (w *fsnotifyWatcher) Close() error {
+	close(w.done)
+	return w.watcher.Close()
+}
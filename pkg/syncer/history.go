@@ -0,0 +1,266 @@
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// dateLayouts are the accepted layouts of a date given on the command line, in local time.
+var dateLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// ParseDate parses a date given on the command line, a date without the time of the day is the
+// end of the day.
+func ParseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			if layout == dateLayouts[0] {
+				// The whole day
+				t = t.AddDate(0, 0, 1).Add(-time.Second)
+			}
+
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %s, expect the format like 2024-01-31 or 2024-01-31 20:00", s)
+}
+
+// findSnapshotRef returns the snapshot referred to by ref, ~N refers to the snapshot N versions
+// before the latest one, otherwise see findSnapshot.
+func findSnapshotRef(snapshots []snapshot, ref string) (snapshot, error) {
+	if !strings.HasPrefix(ref, "~") {
+		return findSnapshot(snapshots, ref)
+	}
+
+	n, err := strconv.Atoi(ref[1:])
+	if err != nil || n < 0 {
+		return snapshot{}, fmt.Errorf("invalid snapshot %s, expect ~N for N versions ago", ref)
+	}
+
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if snapshots[i].Conflict {
+			continue
+		}
+
+		if n == 0 {
+			return snapshots[i], nil
+		}
+
+		n--
+	}
+
+	return snapshot{}, fmt.Errorf("snapshot %s is not found", ref)
+}
+
+// snapshotAt returns the latest snapshot uploaded at t, nil if there is none.
+func snapshotAt(snapshots []snapshot, t time.Time) *snapshot {
+	var at []snapshot
+	for _, s := range snapshots {
+		if !s.Time.After(t) {
+			at = append(at, s)
+		}
+	}
+
+	return latestSnapshot(at)
+}
+
+// RestorePlan is a snapshot to restore of a game.
+type RestorePlan struct {
+	info     GameInfo
+	snapshot snapshot
+	latest   snapshot
+}
+
+// PlanRestore returns the snapshot of the game referred to by ref, or the latest one at the
+// time at if ref is empty. It's nil if the game has no snapshot at that time.
+func (s *Syncer) PlanRestore(info GameInfo, ref string, at time.Time) (*RestorePlan, error) {
+	snapshots, err := listSnapshots(s.transfer, info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := latestSnapshot(snapshots)
+	if latest == nil {
+		return nil, fmt.Errorf("no remote game save of %s", info.Name)
+	}
+
+	if ref != "" {
+		snap, err := findSnapshotRef(snapshots, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		return &RestorePlan{info, snap, *latest}, nil
+	}
+
+	snap := snapshotAt(snapshots, at)
+	if snap == nil {
+		return nil, nil
+	}
+
+	return &RestorePlan{info, *snap, *latest}, nil
+}
+
+// restoreSnapshot replaces the local game save with an earlier snapshot. The restored game save
+// is kept until it's changed, then it's uploaded as usual.
+func (s *Syncer) restoreSnapshot(plan *RestorePlan) error {
+	err := s.download(plan.info, plan.snapshot.Name)
+	if err == nil {
+		// The game save is in sync with the latest snapshot since it's chosen over it.
+		err = s.state.update(plan.info.Name, func(g *gameState) {
+			g.Snapshot = plan.latest.Name
+		})
+	}
+
+	return s.record(plan.info.Name, outcomeDownloaded, err)
+}
+
+// PrintRestorePlans prints the snapshots to restore of the games.
+func PrintRestorePlans(w io.Writer, plans []*RestorePlan) {
+	for _, plan := range plans {
+		fmt.Fprintf(w, "%s: %s (%s)\n", plan.info.Name, plan.snapshot.Name, plan.snapshot.Time.Local().Format("2006-01-02 15:04:05"))
+	}
+}
+
+// RestoreGames restores the planned snapshots, a game which fails to restore doesn't stop the
+// others. A summary of every game is printed to w at the end, and an error is returned if any
+// of them failed.
+func (s *Syncer) RestoreGames(w io.Writer, plans []*RestorePlan) error {
+	games := make([]GameInfo, len(plans))
+	errs := make([]error, len(plans))
+	for i, plan := range plans {
+		games[i] = plan.info
+		if errs[i] = s.restoreSnapshot(plan); errs[i] != nil {
+			log.Printf("Failed to restore %s, err=%s\n", plan.info.Name, errs[i])
+		}
+	}
+
+	return s.printSummary(w, games, errs)
+}
+
+// SnapshotListing is a snapshot as it's listed by the list command.
+type SnapshotListing struct {
+	Game     string    `json:"game"`
+	Name     string    `json:"name"`
+	Time     time.Time `json:"time"`
+	Seq      int64     `json:"seq"`
+	Size     int64     `json:"size"`
+	DeviceID string    `json:"deviceID,omitempty"`
+	Device   string    `json:"device,omitempty"`
+	Conflict bool      `json:"conflict,omitempty"`
+	Pinned   bool      `json:"pinned,omitempty"`
+	Label    string    `json:"label,omitempty"`
+	Note     string    `json:"note,omitempty"`
+	// Local is true if the snapshot has the content of the local game save
+	Local bool `json:"local"`
+}
+
+// ListGame returns the snapshots of the game, the latest first.
+func (s *Syncer) ListGame(info GameInfo) ([]SnapshotListing, error) {
+	tree, err := s.scanGameSave(info)
+	if err != nil {
+		return nil, err
+	}
+
+	saveTime := tree.ModTime()
+	hash, err := s.hash(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := listSnapshots(s.transfer, info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var listings []SnapshotListing
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snap := snapshots[i]
+		meta, err := s.readSnapshotMeta(snap)
+		if err != nil {
+			return nil, err
+		}
+
+		device := ""
+		if snap.Device != "" {
+			device = meta.String()
+		}
+
+		local := snap.hasContent(hash)
+		if snap.Hash == "" && saveTime != nil {
+			local = snap.Time.Unix() == saveTime.Unix()
+		}
+
+		listings = append(listings, SnapshotListing{
+			Game:     info.Name,
+			Name:     snap.Name,
+			Time:     snap.Time.Local(),
+			Seq:      snap.Seq,
+			Size:     snap.Size,
+			DeviceID: snap.Device,
+			Device:   device,
+			Conflict: snap.Conflict,
+			Pinned:   meta.Pinned,
+			Label:    meta.Label,
+			Note:     meta.Note,
+			Local:    local,
+		})
+	}
+
+	return listings, nil
+}
+
+// PrintListings prints the snapshots to w as a table, or as JSON if asJSON is true.
+func PrintListings(w io.Writer, listings []SnapshotListing, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(listings)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GAME\tTIME\tSIZE\tDEVICE\tLOCAL\tNAME\tLABEL\tNOTE")
+	for _, l := range listings {
+		local := ""
+		if l.Local {
+			local = "*"
+		}
+
+		name := path.Base(l.Name)
+		if l.Conflict {
+			name += " (conflict)"
+		}
+
+		if l.Pinned {
+			name += " (pinned)"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", l.Game, l.Time.Format("2006-01-02 15:04:05"),
+			formatSize(l.Size), l.Device, local, name, l.Label, l.Note)
+	}
+
+	return tw.Flush()
+}
+
+// formatSize returns the size in bytes in a human readable unit.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,112 @@
+package syncer
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestFindSnapshotRef(t *testing.T) {
+	snapshots := []snapshot{
+		{Name: "Game/20240101120000_s1.zip"},
+		{Name: "Game/20240102120000_s2.zip"},
+		{Name: "Game/20240102130000_s2_conflict.zip", Conflict: true},
+		{Name: "Game/20240103120000_s3.zip"},
+	}
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"~0", "Game/20240103120000_s3.zip", false},
+		{"~1", "Game/20240102120000_s2.zip", false},
+		{"~2", "Game/20240101120000_s1.zip", false},
+		{"~3", "", true},
+		{"~-1", "", true},
+		{"~x", "", true},
+		{"20240101", "Game/20240101120000_s1.zip", false},
+		{"Game/20240102130000_s2_conflict.zip", "Game/20240102130000_s2_conflict.zip", false},
+		{"20240102", "", true},
+		{"2023", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := findSnapshotRef(snapshots, test.ref)
+		if got.Name != test.want || (err != nil) != test.wantErr {
+			t.Errorf("findSnapshotRef(%q) = %q, %v, want %q, error %v", test.ref, got.Name, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestRestoreGames(t *testing.T) {
+	day := func(d, hour int) time.Time {
+		return time.Date(2024, 2, d, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		ref  string
+		at   time.Time
+		want string
+	}{
+		{"latest", "~0", time.Time{}, "s3"},
+		{"versions ago", "~2", time.Time{}, "s1"},
+		{"prefix", "20240202", time.Time{}, "s2"},
+		{"at a time", "", day(2, 18), "s2"},
+		{"at the time of a snapshot", "", day(3, 12), "s3"},
+		{"before the first", "", day(1, 11), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := newMemFS()
+			tr := newMemTransfer(fs)
+			a := newFakeDevice(t, fs, tr, "a", Options{})
+			path := a.savePath("save.sav")
+			for i, content := range []string{"s1", "s2", "s3"} {
+				fs.writeFile(t, path, content)
+				if err := fs.Chtimes(path, day(i+1, 12), day(i+1, 12)); err != nil {
+					t.Fatal(err)
+				}
+
+				a.sync(t, outcomeUploaded)
+			}
+
+			fs.writeFile(t, path, "local")
+			plan, err := a.PlanRestore(a.info, test.ref, test.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.want == "" {
+				if plan != nil {
+					t.Fatalf("PlanRestore() = %s, want none", plan.snapshot.Name)
+				}
+
+				return
+			}
+
+			if err = a.RestoreGames(ioutil.Discard, []*RestorePlan{plan}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := fs.readFile(t, path); got != test.want {
+				t.Errorf("save.sav = %q, want %q", got, test.want)
+			}
+
+			// The restored game save is kept by the next sync, and uploaded once it changes.
+			a.sync(t, outcomeInSync)
+			if got := fs.readFile(t, path); got != test.want {
+				t.Errorf("save.sav after a sync = %q, want %q", got, test.want)
+			}
+
+			fs.writeFile(t, path, test.want+"+")
+			a.sync(t, outcomeUploaded)
+			contents := snapshotContents(t, a)
+			if got := contents[len(contents)-1]; got != test.want+"+" {
+				t.Errorf("latest snapshot = %q, want %q", got, test.want+"+")
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// metaSuffix is appended to the object name of a snapshot to name its metadata sidecar.
+const metaSuffix = ".json"
+
+// snapshotMeta is the metadata of a snapshot, it's kept in a sidecar object next to the snapshot.
+type snapshotMeta struct {
+	// Device is the ID of the device which uploaded the snapshot
+	Device     string `json:"device,omitempty"`
+	DeviceName string `json:"deviceName,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+	// Version is the version of gamesave-sync which uploaded the snapshot
+	Version string `json:"version,omitempty"`
+	// Pinned snapshots are never pruned nor moved to conflict snapshots, a newer snapshot still
+	// becomes the latest one
+	Pinned bool `json:"pinned,omitempty"`
+	// Label and Note are given by the user to find the snapshot later, such as "before final boss"
+	Label string `json:"label,omitempty"`
+	Note  string `json:"note,omitempty"`
+}
+
+// DeviceInfo identifies this device in the snapshots it uploads.
+type DeviceInfo struct {
+	ID       string
+	Name     string
+	Hostname string
+}
+
+// Matches reports whether the device is one of the device names or IDs, every device matches
+// an empty list.
+func (d DeviceInfo) Matches(devices []string) bool {
+	if len(devices) == 0 {
+		return true
+	}
+
+	for _, device := range devices {
+		if strings.EqualFold(device, d.Name) || device == d.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newSnapshotMeta returns the metadata of a snapshot uploaded by the device.
+func newSnapshotMeta(device DeviceInfo, label, note string) *snapshotMeta {
+	return &snapshotMeta{
+		Device:     device.ID,
+		DeviceName: device.Name,
+		Hostname:   device.Hostname,
+		Version:    Version,
+		Label:      label,
+		Note:       note,
+	}
+}
+
+// String describes the device which uploaded the snapshot.
+func (m *snapshotMeta) String() string {
+	switch {
+	case m.DeviceName == "":
+		return "unknown device"
+	case m.DeviceName == m.Hostname:
+		return m.DeviceName
+	default:
+		return fmt.Sprintf("%s (%s)", m.DeviceName, m.Hostname)
+	}
+}
+
+// readSnapshotMeta returns the metadata of the snapshot, empty if it has no sidecar.
+func (s *Syncer) readSnapshotMeta(snap snapshot) (*snapshotMeta, error) {
+	meta := new(snapshotMeta)
+	if !snap.HasMeta {
+		return meta, nil
+	}
+
+	tmpPath, err := s.fs.TempFile(s.appData, "meta-*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.fs.Remove(tmpPath)
+	if err = s.transfer.Download(snap.Name+metaSuffix, tmpPath); err != nil {
+		return nil, err
+	}
+
+	content, err := s.fs.ReadFile(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(content, meta); err != nil {
+		return nil, fmt.Errorf("invalid metadata of %s: %w", snap.Name, err)
+	}
+
+	return meta, nil
+}
+
+// updateSnapshotMeta changes the metadata of the snapshot of the game referred to by ref by update,
+// and returns the snapshot.
+func (s *Syncer) updateSnapshotMeta(info GameInfo, ref string, update func(meta *snapshotMeta)) (snapshot, error) {
+	snapshots, err := listSnapshots(s.transfer, info.Name)
+	if err != nil {
+		return snapshot{}, err
+	}
+
+	snap, err := findSnapshotRef(snapshots, ref)
+	if err != nil {
+		return snapshot{}, err
+	}
+
+	meta, err := s.readSnapshotMeta(snap)
+	if err != nil {
+		return snapshot{}, err
+	}
+
+	update(meta)
+	return snap, s.writeSnapshotMeta(snap, meta)
+}
+
+// SetLabel sets the label and the note of the snapshot of the game referred to by ref, empty ones
+// clear them. The note is kept if it's nil.
+func (s *Syncer) SetLabel(info GameInfo, ref, label string, note *string) error {
+	snap, err := s.updateSnapshotMeta(info, ref, func(meta *snapshotMeta) {
+		meta.Label = label
+		if note != nil {
+			meta.Note = *note
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Successfully set label of %s to %q\n", snap.Name, label)
+	return nil
+}
+
+// writeSnapshotMeta uploads the metadata sidecar of the snapshot.
+func (s *Syncer) writeSnapshotMeta(snap snapshot, meta *snapshotMeta) error {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	tmpPath, err := s.fs.TempFile(s.appData, "meta-*.json")
+	if err != nil {
+		return err
+	}
+
+	defer s.fs.Remove(tmpPath)
+	if err = s.fs.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+
+	return s.transfer.Upload(tmpPath, snap.Name+metaSuffix)
+}
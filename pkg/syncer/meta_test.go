@@ -0,0 +1,80 @@
+package syncer
+
+import "testing"
+
+func TestSnapshotDevice(t *testing.T) {
+	fs := newMemFS()
+	tr := newMemTransfer(fs)
+	a := newFakeDevice(t, fs, tr, "a", Options{DeviceName: "Laptop"})
+	b := newFakeDevice(t, fs, tr, "b", Options{})
+	if a.device.ID == "" || a.device.ID == b.device.ID {
+		t.Fatalf("device IDs %q and %q, want two different ones", a.device.ID, b.device.ID)
+	}
+
+	fs.writeFile(t, a.savePath("save.sav"), "one")
+	a.sync(t, outcomeUploaded)
+	b.sync(t, outcomeDownloaded)
+	fs.writeFile(t, b.savePath("save.sav"), "two")
+	b.sync(t, outcomeUploaded)
+
+	// The ID is kept in the sync state, the device keeps it across runs.
+	again := newFakeDevice(t, fs, tr, "a", Options{DeviceName: "Laptop"})
+	if again.device.ID != a.device.ID {
+		t.Errorf("device ID after a restart = %q, want %q", again.device.ID, a.device.ID)
+	}
+
+	listings, err := a.ListGame(a.info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		id     string
+		device string
+	}{{b.device.ID, "b"}, {a.device.ID, "Laptop (a)"}}
+	if len(listings) != len(want) {
+		t.Fatalf("%d snapshots listed, want %d", len(listings), len(want))
+	}
+
+	for i, listing := range listings {
+		if listing.DeviceID != want[i].id || listing.Device != want[i].device {
+			t.Errorf("snapshot %s uploaded by %q (%s), want %q (%s)", listing.Name, listing.Device, listing.DeviceID,
+				want[i].device, want[i].id)
+		}
+	}
+
+	snapshots, err := listSnapshots(tr, a.info.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := a.readSnapshotMeta(snapshots[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *meta != (snapshotMeta{Device: a.device.ID, DeviceName: "Laptop", Hostname: "a", Version: Version}) {
+		t.Errorf("metadata = %+v, want the device a", *meta)
+	}
+}
+
+func TestDeviceInfoMatches(t *testing.T) {
+	device := DeviceInfo{ID: "0123456789abcdef", Name: "Steam Deck", Hostname: "steamdeck"}
+	tests := []struct {
+		devices []string
+		want    bool
+	}{
+		{nil, true},
+		{[]string{"Steam Deck"}, true},
+		{[]string{"laptop", "steam deck"}, true},
+		{[]string{"0123456789abcdef"}, true},
+		{[]string{"steamdeck"}, false},
+		{[]string{"laptop"}, false},
+	}
+
+	for _, test := range tests {
+		if got := device.Matches(test.devices); got != test.want {
+			t.Errorf("Matches(%q) = %v, want %v", test.devices, got, test.want)
+		}
+	}
+}
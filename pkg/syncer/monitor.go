@@ -0,0 +1,96 @@
+package syncer
+
+import (
+	"log"
+	"time"
+)
+
+// Monitor watches the game save directories of the game and syncs the game save after it changes,
+// once the game exits. It returns when the directories can't be watched any more.
+func (s *Syncer) Monitor(info GameInfo) {
+	watcher, err := s.fs.Watch()
+	if err != nil {
+		log.Printf("Failed to monitor %s, err=%s\n", info.Name, err)
+		return
+	}
+	defer watcher.Close()
+
+	s.watchGameSave(watcher, info)
+	gameSaveModify := false
+	for {
+		select {
+		case name, ok := <-watcher.Changes():
+			if !ok {
+				return
+			}
+
+			log.Println("modified file:", name)
+			gameSaveModify = true
+		case err, ok := <-watcher.Errors():
+			if !ok {
+				return
+			}
+
+			log.Println("error:", err)
+		case <-time.After(time.Second * 5):
+		}
+
+		if !gameSaveModify {
+			continue
+		}
+
+		outcome, synced := s.syncGameIfGameExited(info)
+		if !synced {
+			continue
+		}
+
+		gameSaveModify = false
+		if outcome == outcomeDownloaded {
+			// The restore swaps the directories, the watches stay on the ones swapped out.
+			s.unwatchGameSave(watcher, info)
+			s.watchGameSave(watcher, info)
+		}
+	}
+}
+
+// watchGameSave adds the existing directories of the components to the watcher.
+func (s *Syncer) watchGameSave(watcher Watcher, info GameInfo) {
+	for _, component := range info.Components {
+		if s.isDir(component.Dir) {
+			if err := watcher.Add(component.Dir); err != nil {
+				log.Printf("Failed to monitor %s, err=%s\n", component.Dir, err)
+			}
+		}
+	}
+}
+
+// unwatchGameSave removes the directories of the components from the watcher, the ones which
+// aren't watched are ignored.
+func (s *Syncer) unwatchGameSave(watcher Watcher, info GameInfo) {
+	for _, component := range info.Components {
+		_ = watcher.Remove(component.Dir)
+	}
+}
+
+// syncGameIfGameExited syncs the game save like SyncGame once the game exits, so the game save
+// may be uploaded, downloaded or left alone on a conflict. It reports whether the game save
+// was synced and its outcome.
+func (s *Syncer) syncGameIfGameExited(info GameInfo) (syncOutcome, bool) {
+	running, err := s.processes.Running(info.ProcName)
+	if err != nil {
+		log.Printf("Failed to list the processes, err=%s\n", err)
+		return outcomeFailed, false
+	}
+
+	if running {
+		return outcomeFailed, false
+	}
+
+	outcome, err := s.sync(info)
+	if err = s.record(info.Name, outcome, err); err != nil {
+		log.Printf("Failed to sync %s, err=%s\n", info.Name, err)
+		return outcomeFailed, false
+	}
+
+	return outcome, true
+}
@@ -0,0 +1,54 @@
+package syncer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMonitor(t *testing.T) {
+	fs := newMemFS()
+	tr := newMemTransfer(fs)
+	a := newFakeDevice(t, fs, tr, "a", Options{})
+	b := newFakeDevice(t, fs, tr, "b", Options{})
+	fs.writeFile(t, a.savePath("save.sav"), "one")
+	a.sync(t, outcomeUploaded)
+	b.sync(t, outcomeDownloaded)
+	fs.writeFile(t, b.savePath("save.sav"), "two")
+	b.sync(t, outcomeUploaded)
+
+	a.processes.setRunning(true)
+	done := make(chan struct{})
+	go func() {
+		a.Monitor(a.info)
+		close(done)
+	}()
+
+	// Each send returns once the monitor is done with the one before. The game save isn't
+	// synced while the game runs, then a single time after it exits.
+	w := <-fs.watches
+	w.changes <- a.savePath("save.sav")
+	w.errors <- errors.New("overflow")
+	a.processes.setRunning(false)
+	w.errors <- errors.New("overflow")
+	w.errors <- errors.New("overflow")
+	w.Close()
+	<-done
+
+	if got := fs.readFile(t, a.savePath("save.sav")); got != "two" {
+		t.Errorf("save.sav = %q, want %q", got, "two")
+	}
+
+	if got := a.state.get(a.info.Name).Outcome; got != outcomeDownloaded {
+		t.Errorf("outcome = %s, want %s", got, outcomeDownloaded)
+	}
+
+	if a.processes.calls != 3 {
+		t.Errorf("the processes are listed %d times, want 3", a.processes.calls)
+	}
+
+	dir := a.info.Components[0].Dir
+	if want := []string{"add " + dir, "remove " + dir, "add " + dir}; !reflect.DeepEqual(w.calls, want) {
+		t.Errorf("watcher calls = %q, want %q", w.calls, want)
+	}
+}
@@ -0,0 +1,27 @@
+package syncer
+
+import "github.com/mitchellh/go-ps"
+
+// ProcessLister tells whether a game is running, its game save is synced after it exits.
+type ProcessLister interface {
+	// Running reports whether a process of the executable is running.
+	Running(executable string) (bool, error)
+}
+
+// PSProcessLister lists the processes of the operating system.
+type PSProcessLister struct{}
+
+func (PSProcessLister) Running(executable string) (bool, error) {
+	processes, err := ps.Processes()
+	if err != nil {
+		return false, err
+	}
+
+	for _, proc := range processes {
+		if proc.Executable() == executable {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,394 @@
+package syncer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+)
+
+const (
+	stagingSuffix = ".gamesave-staging"
+	backupSuffix  = ".gamesave-old"
+)
+
+type restorePhase string
+
+const (
+	// phaseExtract extracts the archive into the staging directory, the game save is untouched.
+	phaseExtract restorePhase = "extract"
+	// phaseBackup moves the current game save files into the backup directory.
+	phaseBackup restorePhase = "backup"
+	// phaseInstall moves the extracted files from the staging directory into place.
+	phaseInstall restorePhase = "install"
+)
+
+// restoreTarget is the save location of one component being restored.
+type restoreTarget struct {
+	Target  string   `json:"target"`
+	Staging string   `json:"staging"`
+	Backup  string   `json:"backup"`
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	Files   []string `json:"files,omitempty"`
+}
+
+// restoreJournal records an in-progress restore of a game save, so an interrupted
+// restore is rolled back or finished on the next start.
+type restoreJournal struct {
+	fs      FS
+	path    string
+	Targets map[string]*restoreTarget `json:"targets"`
+	Phase   restorePhase              `json:"phase"`
+}
+
+func getJournalDir(appData string) string {
+	return filepath.Join(appData, "journal")
+}
+
+// restoreGameSave replaces the files of the game save components selected by their filters
+// with the content of the archive. The archive is extracted and verified next to each
+// component first, the old files are kept until the new ones are in place. The named components
+// missing from the archive, not found on the device which uploaded it, are left alone.
+func (s *Syncer) restoreGameSave(info GameInfo, archivePath string) error {
+	journalPath := filepath.Join(getJournalDir(s.appData), info.Name+".json")
+	j := &restoreJournal{fs: s.fs, path: journalPath, Targets: map[string]*restoreTarget{}}
+	destinations := ziputils.Destinations{}
+	for _, component := range info.Components {
+		t := &restoreTarget{
+			Target:  component.Dir,
+			Staging: component.Dir + stagingSuffix,
+			Backup:  component.Dir + backupSuffix,
+		}
+
+		if component.Filter != nil {
+			t.Include, t.Exclude, t.Files = component.Filter.Include, component.Filter.Exclude, component.Filter.Files
+		}
+
+		if _, err := s.fs.Stat(t.Backup); err == nil {
+			return fmt.Errorf("backup of an earlier restore is left in %s, please check it", t.Backup)
+		}
+
+		if err := s.fs.RemoveAll(t.Staging); err != nil {
+			return err
+		}
+
+		j.Targets[component.Name] = t
+		destinations[component.Name] = t.Staging
+	}
+
+	reserve, err := s.reserveSpace(j.Targets)
+	if err != nil {
+		return err
+	}
+
+	if err = j.save(phaseExtract); err != nil {
+		return err
+	}
+
+	names, err := ziputils.ExtractTo(s.fs, archivePath, destinations, ziputils.ExtractOptions{Limits: s.limits, Reserve: reserve})
+	if err != nil {
+		if cleanErr := j.discard(); cleanErr != nil {
+			log.Println(cleanErr)
+		}
+
+		return err
+	}
+
+	// Nothing is extracted into the staging directory of a missing component.
+	for name := range j.Targets {
+		if name != "" && !names[name] {
+			delete(j.Targets, name)
+		}
+	}
+
+	return j.finish()
+}
+
+// reserveSpace returns the Reserve function of extracting into the staging directories of the
+// targets. It fails before the files going to a volume outgrow its free space, which is read once
+// for each volume.
+func (s *Syncer) reserveSpace(targets map[string]*restoreTarget) (func(name string, size int64) error, error) {
+	volumes := map[string]string{}
+	free := map[string]uint64{}
+	for name, t := range targets {
+		dir := filepath.Dir(t.Target)
+		if err := s.fs.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+
+		volume, err := s.fs.Volume(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		volumes[name] = volume
+		if _, ok := free[volume]; !ok {
+			if free[volume], err = s.fs.DiskFree(dir); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	used := map[string]uint64{}
+	return func(name string, size int64) error {
+		volume := volumes[name]
+		if used[volume]+uint64(size) > free[volume] {
+			return fmt.Errorf("not enough disk space to restore %s: need more than %d bytes, %d bytes available",
+				targets[name].Target, used[volume]+uint64(size), free[volume])
+		}
+
+		used[volume] += uint64(size)
+		return nil
+	}, nil
+}
+
+// RecoverRestores rolls back or finishes the restores interrupted by the last run. It moves the
+// game save files, so it's called before syncing rather than by the read only commands.
+func (s *Syncer) RecoverRestores() {
+	dir := getJournalDir(s.appData)
+	files, err := s.fs.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Println(err)
+		}
+
+		return
+	}
+
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		j, err := loadRestoreJournal(s.fs, filepath.Join(dir, file.Name()))
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		log.Printf("Recovering interrupted restore %s in phase %s\n", j.path, j.Phase)
+		if j.Phase == phaseExtract {
+			err = j.discard()
+		} else {
+			err = j.finish()
+		}
+
+		if err != nil {
+			log.Printf("Failed to recover restore %s, err=%s\n", j.path, err)
+		}
+	}
+}
+
+func loadRestoreJournal(fs FS, path string) (*restoreJournal, error) {
+	content, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &restoreJournal{fs: fs, path: path}
+	if err = json.Unmarshal(content, j); err != nil {
+		return nil, fmt.Errorf("invalid restore journal %s: %w", path, err)
+	}
+
+	return j, nil
+}
+
+func (j *restoreJournal) save(phase restorePhase) error {
+	j.Phase = phase
+	content, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	if err = j.fs.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(j.fs, j.path, content)
+}
+
+func (t *restoreTarget) filter() *ziputils.Filter {
+	filter, _ := ziputils.NewFilter(t.Include, t.Exclude, t.Files)
+	return filter
+}
+
+// discard drops the staging directories of a restore which hasn't touched the game save yet.
+func (j *restoreJournal) discard() error {
+	for _, t := range j.Targets {
+		if err := j.fs.RemoveAll(t.Staging); err != nil {
+			return err
+		}
+	}
+
+	return j.fs.Remove(j.path)
+}
+
+// finish moves the old files out of the way and the extracted files into place, continuing
+// from the recorded phase. It rolls back to the old files if that fails.
+func (j *restoreJournal) finish() error {
+	var err error
+	if j.Phase != phaseInstall {
+		if err = j.save(phaseBackup); err == nil {
+			for _, t := range j.Targets {
+				if err = moveGameSave(j.fs, t.Target, t.Backup, t.filter()); err != nil {
+					break
+				}
+			}
+		}
+	}
+
+	if err == nil {
+		if err = j.save(phaseInstall); err == nil {
+			for _, t := range j.Targets {
+				if err = moveGameSave(j.fs, t.Staging, t.Target, t.filter()); err != nil {
+					break
+				}
+			}
+		}
+	}
+
+	if err != nil {
+		if rollbackErr := j.rollback(); rollbackErr != nil {
+			return fmt.Errorf("%w, and failed to roll back: %s", err, rollbackErr)
+		}
+
+		return err
+	}
+
+	for _, t := range j.Targets {
+		if err = j.fs.RemoveAll(t.Backup); err != nil {
+			return err
+		}
+	}
+
+	return j.discard()
+}
+
+// rollback puts the old files back into place.
+func (j *restoreJournal) rollback() error {
+	for _, t := range j.Targets {
+		filter := t.filter()
+		if j.Phase == phaseInstall {
+			// Every old file is in the backup directory at this point.
+			if err := removeGameSave(j.fs, t.Target, filter); err != nil {
+				return err
+			}
+		}
+
+		if err := moveGameSave(j.fs, t.Backup, t.Target, filter); err != nil {
+			return err
+		}
+
+		if err := j.fs.RemoveAll(t.Backup); err != nil {
+			return err
+		}
+	}
+
+	return j.discard()
+}
+
+// moveGameSave moves the files of the game save in src selected by filter to dst, keeping
+// their relative paths. Without filter the whole directory is renamed.
+func moveGameSave(fs FS, src, dst string, filter *ziputils.Filter) error {
+	if _, err := fs.Stat(src); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if filter == nil {
+		if _, err := fs.Stat(dst); errors.Is(err, os.ErrNotExist) {
+			return fs.Rename(src, dst)
+		}
+	}
+
+	return fs.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		name = filepath.ToSlash(name)
+		if path == src {
+			return nil
+		}
+
+		if info.IsDir() && filter.Excluded(name) {
+			return filepath.SkipDir
+		}
+
+		if !filter.Match(name) {
+			return nil
+		}
+
+		dstPath := filepath.Join(dst, name)
+		if info.IsDir() {
+			return fs.MkdirAll(dstPath, info.Mode().Perm())
+		}
+
+		if err = fs.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+			return err
+		}
+
+		return fs.Rename(path, dstPath)
+	})
+}
+
+// removeGameSave removes the files of the game save selected by filter, the files
+// left out of snapshots are kept.
+func removeGameSave(fs FS, dir string, filter *ziputils.Filter) error {
+	if filter == nil {
+		return fs.RemoveAll(dir)
+	}
+
+	var dirs []string
+	err := fs.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		name = filepath.ToSlash(name)
+		if path == dir {
+			return nil
+		}
+
+		if info.IsDir() && filter.Excluded(name) {
+			return filepath.SkipDir
+		}
+
+		if !filter.Match(name) {
+			return nil
+		}
+
+		if info.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+
+		return fs.Remove(path)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Remove the selected directories which are empty now, children first.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = fs.Remove(dirs[i])
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package syncer
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreGameSaveKeepsMissingComponents(t *testing.T) {
+	root := t.TempDir()
+	s, err := New(Options{AppData: root, Limits: ziputils.DefaultLimits})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	game := func(device string) GameInfo {
+		return GameInfo{
+			Name: "Game",
+			Components: []Component{
+				{Name: "saves", Dir: filepath.Join(root, device, "saves")},
+				{Name: "cfg", Dir: filepath.Join(root, device, "cfg")},
+			},
+			Archive: ziputils.Options{Format: ziputils.FormatZip},
+		}
+	}
+
+	// Device a has no cfg directory, so its snapshot has no cfg.
+	writeFile(t, filepath.Join(root, "a", "saves", "save.sav"), "new")
+	tree, err := s.scanGameSave(game("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(root, "snapshot.zip")
+	if err = ziputils.ArchiveTree(s.fs, tree, archivePath, game("a").Archive); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(root, "b", "saves", "save.sav"), "old")
+	writeFile(t, filepath.Join(root, "b", "cfg", "settings.ini"), "settings")
+	if err = s.restoreGameSave(game("b"), archivePath); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		filepath.Join(root, "b", "saves", "save.sav"):   "new",
+		filepath.Join(root, "b", "cfg", "settings.ini"): "settings",
+	} {
+		got, err := ioutil.ReadFile(path)
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", path, got, err, want)
+		}
+	}
+}
+
+// volumeFS puts each directory under root on the volume named by its first element, with free
+// bytes available on every volume.
+type volumeFS struct {
+	OSFS
+	root string
+	free uint64
+}
+
+func (fs volumeFS) Volume(path string) (string, error) {
+	rel, err := filepath.Rel(fs.root, path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Split(filepath.ToSlash(rel), "/")[0], nil
+}
+
+func (fs volumeFS) DiskFree(path string) (uint64, error) {
+	return fs.free, nil
+}
+
+func TestRestoreGameSaveChecksSpacePerVolume(t *testing.T) {
+	tests := []struct {
+		name    string
+		volumes [2]string
+		wantErr bool
+	}{
+		{"same volume", [2]string{"c", "c"}, true},
+		{"different volumes", [2]string{"c", "d"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			s, err := New(Options{AppData: root, FS: volumeFS{root: root, free: 1000}, Limits: ziputils.DefaultLimits})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			src := GameInfo{
+				Name: "Game",
+				Components: []Component{
+					{Name: "saves", Dir: filepath.Join(root, "src", "saves")},
+					{Name: "cfg", Dir: filepath.Join(root, "src", "cfg")},
+				},
+				Archive: ziputils.Options{Format: ziputils.FormatZip},
+			}
+			writeFile(t, filepath.Join(root, "src", "saves", "save.sav"), strings.Repeat("s", 600))
+			writeFile(t, filepath.Join(root, "src", "cfg", "settings.ini"), strings.Repeat("c", 600))
+			tree, err := s.scanGameSave(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			archivePath := filepath.Join(root, "snapshot.zip")
+			if err = ziputils.ArchiveTree(s.fs, tree, archivePath, src.Archive); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := src
+			dst.Components = []Component{
+				{Name: "saves", Dir: filepath.Join(root, test.volumes[0], "saves")},
+				{Name: "cfg", Dir: filepath.Join(root, test.volumes[1], "cfg")},
+			}
+			err = s.restoreGameSave(dst, archivePath)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("restoreGameSave() = %v, want error %v", err, test.wantErr)
+			}
+
+			_, statErr := os.Stat(filepath.Join(root, test.volumes[0], "saves", "save.sav"))
+			if restored := statErr == nil; restored == test.wantErr {
+				t.Errorf("save.sav restored = %v, want %v", restored, !test.wantErr)
+			}
+		})
+	}
+}
+
+func BenchmarkRestoreGameSave(b *testing.B) {
+	for _, format := range []ziputils.Format{ziputils.FormatZip, ziputils.FormatTarZstd} {
+		b.Run(string(format), func(b *testing.B) {
+			root := b.TempDir()
+			s, err := New(Options{AppData: root, Limits: ziputils.DefaultLimits})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			info := GameInfo{
+				Name:       "Game",
+				Components: []Component{{Dir: filepath.Join(root, "save")}},
+				Archive:    ziputils.Options{Format: format},
+			}
+
+			content := make([]byte, 1<<20)
+			rand.New(rand.NewSource(1)).Read(content)
+			for i := 0; i < 32; i++ {
+				path := filepath.Join(root, "save", "save"+strconv.Itoa(i)+".sav")
+				if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					b.Fatal(err)
+				}
+
+				if err = ioutil.WriteFile(path, content, 0644); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			tree, err := s.scanGameSave(info)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			archivePath := filepath.Join(root, "snapshot."+format.Ext())
+			if err = ziputils.ArchiveTree(s.fs, tree, archivePath, info.Archive); err != nil {
+				b.Fatal(err)
+			}
+
+			b.SetBytes(32 << 20)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err = s.restoreGameSave(info, archivePath); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
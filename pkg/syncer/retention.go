@@ -0,0 +1,161 @@
+package syncer
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// RetentionPolicy decides which snapshots of a game are kept in the remote storage. A snapshot
+// is kept if any count rule keeps it, and the oldest ones are removed beyond MaxSize. Zero means
+// no limit, and without count rules every snapshot is kept.
+type RetentionPolicy struct {
+	KeepLast    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	MaxSize     int64
+	// PruneAfterUpload prunes the snapshots of a game after each upload
+	PruneAfterUpload bool
+}
+
+// RetentionRule overrides the retention policy of config.ini for a game, the missing fields
+// keep the value of config.ini.
+type RetentionRule struct {
+	KeepLast    *int   `json:"keepLast"`
+	KeepDaily   *int   `json:"keepDaily"`
+	KeepWeekly  *int   `json:"keepWeekly"`
+	KeepMonthly *int   `json:"keepMonthly"`
+	MaxSize     *int64 `json:"maxSize"`
+}
+
+func (p RetentionPolicy) merge(rule *RetentionRule) RetentionPolicy {
+	if rule == nil {
+		return p
+	}
+
+	for _, field := range []struct {
+		dst *int
+		src *int
+	}{
+		{&p.KeepLast, rule.KeepLast},
+		{&p.KeepDaily, rule.KeepDaily},
+		{&p.KeepWeekly, rule.KeepWeekly},
+		{&p.KeepMonthly, rule.KeepMonthly},
+	} {
+		if field.src != nil {
+			*field.dst = *field.src
+		}
+	}
+
+	if rule.MaxSize != nil {
+		p.MaxSize = *rule.MaxSize
+	}
+
+	return p
+}
+
+// keep returns which of the snapshots, oldest first, the count rules keep.
+func (p RetentionPolicy) keep(snapshots []snapshot) []bool {
+	keep := make([]bool, len(snapshots))
+	if p.KeepLast == 0 && p.KeepDaily == 0 && p.KeepWeekly == 0 && p.KeepMonthly == 0 {
+		for i := range keep {
+			keep[i] = true
+		}
+
+		return keep
+	}
+
+	for i := len(snapshots) - 1; i >= 0 && i >= len(snapshots)-p.KeepLast; i-- {
+		keep[i] = true
+	}
+
+	// keepPeriods keeps the newest snapshot of each of the last n periods which have one.
+	keepPeriods := func(n int, period func(t time.Time) string) {
+		seen := map[string]bool{}
+		for i := len(snapshots) - 1; i >= 0 && len(seen) < n; i-- {
+			key := period(snapshots[i].Time.Local())
+			if !seen[key] {
+				seen[key] = true
+				keep[i] = true
+			}
+		}
+	}
+
+	keepPeriods(p.KeepDaily, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	keepPeriods(p.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+	keepPeriods(p.KeepMonthly, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+
+	return keep
+}
+
+// Prune removes the snapshots of the game beyond its retention policy. The latest snapshot
+// and the pinned snapshots are never removed.
+func (s *Syncer) Prune(info GameInfo) error {
+	policy := s.retention.merge(info.Retention)
+	snapshots, err := listSnapshots(s.transfer, info.Name)
+	if err != nil {
+		return err
+	}
+
+	latest := latestSnapshot(snapshots)
+	keep := policy.keep(snapshots)
+	var size int64
+	for _, snap := range snapshots {
+		size += snap.Size
+	}
+
+	for i, snap := range snapshots {
+		if keep[i] && (policy.MaxSize == 0 || size <= policy.MaxSize) {
+			continue
+		}
+
+		if latest != nil && snap.Name == latest.Name {
+			continue
+		}
+
+		meta, err := s.readSnapshotMeta(snap)
+		if err != nil {
+			return err
+		}
+
+		if meta.Pinned {
+			continue
+		}
+
+		if err = s.transfer.Remove(snap.Name); err != nil {
+			return err
+		}
+
+		if snap.HasMeta {
+			if err = s.transfer.Remove(snap.Name + metaSuffix); err != nil {
+				return err
+			}
+		}
+
+		size -= snap.Size
+		log.Printf("Pruned %s\n", snap.Name)
+	}
+
+	return nil
+}
+
+// SetPinned pins or unpins the snapshot of the game referred to by ref.
+func (s *Syncer) SetPinned(info GameInfo, ref string, pinned bool) error {
+	snap, err := s.updateSnapshotMeta(info, ref, func(meta *snapshotMeta) {
+		meta.Pinned = pinned
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Successfully set pinned of %s to %v\n", snap.Name, pinned)
+	return nil
+}
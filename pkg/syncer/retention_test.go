@@ -0,0 +1,150 @@
+package syncer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyKeep(t *testing.T) {
+	day := func(month time.Month, d int) snapshot {
+		return snapshot{Time: time.Date(2024, month, d, 12, 0, 0, 0, time.Local)}
+	}
+
+	// Mon 1 Jan, Tue 2 Jan twice, Mon 8 Jan, Thu 1 Feb, Fri 2 Feb
+	snapshots := []snapshot{day(1, 1), day(1, 2), day(1, 2), day(1, 8), day(2, 1), day(2, 2)}
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []bool
+	}{
+		{"no rule", RetentionPolicy{}, []bool{true, true, true, true, true, true}},
+		{"last", RetentionPolicy{KeepLast: 2}, []bool{false, false, false, false, true, true}},
+		{"daily", RetentionPolicy{KeepDaily: 4}, []bool{false, false, true, true, true, true}},
+		{"weekly", RetentionPolicy{KeepWeekly: 2}, []bool{false, false, false, true, false, true}},
+		{"monthly", RetentionPolicy{KeepMonthly: 5}, []bool{false, false, false, true, false, true}},
+		{"any rule", RetentionPolicy{KeepLast: 1, KeepMonthly: 2}, []bool{false, false, false, true, false, true}},
+		{"size only", RetentionPolicy{MaxSize: 1}, []bool{true, true, true, true, true, true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.keep(snapshots); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("keep() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicyMerge(t *testing.T) {
+	keepLast, maxSize := 30, int64(0)
+	policy := RetentionPolicy{KeepLast: 10, KeepDaily: 7, MaxSize: 100, PruneAfterUpload: true}
+	got := policy.merge(&RetentionRule{KeepLast: &keepLast, MaxSize: &maxSize})
+	want := RetentionPolicy{KeepLast: 30, KeepDaily: 7, PruneAfterUpload: true}
+	if got != want {
+		t.Errorf("merge() = %+v, want %+v", got, want)
+	}
+
+	if got = policy.merge(nil); got != policy {
+		t.Errorf("merge(nil) = %+v, want %+v", got, policy)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	fs := newMemFS()
+	tr := newMemTransfer(fs)
+	a := newFakeDevice(t, fs, tr, "a", Options{Retention: RetentionPolicy{KeepLast: 2}})
+	for _, content := range []string{"one", "two", "three", "four", "five"} {
+		fs.writeFile(t, a.savePath("save.sav"), content)
+		a.sync(t, outcomeUploaded)
+	}
+
+	if err := a.SetPinned(a.info, "~3", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Prune(a.info); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := snapshotContents(t, a), []string{"two", "four", "five"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshots = %q, want %q", got, want)
+	}
+
+	snapshots, err := listSnapshots(tr, a.info.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The metadata of the pruned snapshots is removed with them.
+	var names []string
+	for name := range tr.objects {
+		names = append(names, name)
+	}
+
+	if len(names) != 2*len(snapshots) {
+		t.Errorf("objects = %q, want the %d snapshots and their metadata", names, len(snapshots))
+	}
+}
+
+func TestPrunePolicies(t *testing.T) {
+	keepLast := 3
+	// The snapshots s1 to s5 are saved on the 1st, 1st, 2nd, 3rd and 3rd of February.
+	days := []int{1, 1, 2, 3, 3}
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		rule   *RetentionRule
+		// maxSizeOfLast sets MaxSize to the size of the last snapshots
+		maxSizeOfLast int
+		want          []string
+	}{
+		{"no rule", RetentionPolicy{}, nil, 0, []string{"s1", "s2", "s3", "s4", "s5"}},
+		{"after upload", RetentionPolicy{KeepLast: 2, PruneAfterUpload: true}, nil, 0, []string{"s4", "s5"}},
+		{"daily", RetentionPolicy{KeepDaily: 2}, nil, 0, []string{"s3", "s5"}},
+		{"last or daily", RetentionPolicy{KeepLast: 1, KeepDaily: 3}, nil, 0, []string{"s2", "s3", "s5"}},
+		{"game rule", RetentionPolicy{KeepLast: 1}, &RetentionRule{KeepLast: &keepLast}, 0, []string{"s3", "s4", "s5"}},
+		{"max size", RetentionPolicy{}, nil, 2, []string{"s4", "s5"}},
+		{"latest beyond max size", RetentionPolicy{MaxSize: 1}, nil, 0, []string{"s5"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := newMemFS()
+			tr := newMemTransfer(fs)
+			a := newFakeDevice(t, fs, tr, "a", Options{Retention: test.policy})
+			a.info.Retention = test.rule
+			for i, day := range days {
+				path := a.savePath("save.sav")
+				fs.writeFile(t, path, "s"+string(rune('1'+i)))
+				at := time.Date(2024, 2, day, 10+i, 0, 0, 0, time.Local)
+				if err := fs.Chtimes(path, at, at); err != nil {
+					t.Fatal(err)
+				}
+
+				a.sync(t, outcomeUploaded)
+			}
+
+			if test.maxSizeOfLast > 0 {
+				snapshots, err := listSnapshots(tr, a.info.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, snap := range snapshots[len(snapshots)-test.maxSizeOfLast:] {
+					a.retention.MaxSize += snap.Size
+				}
+			}
+
+			if !test.policy.PruneAfterUpload {
+				if err := a.Prune(a.info); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := snapshotContents(t, a); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("snapshots = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
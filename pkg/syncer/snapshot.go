@@ -0,0 +1,194 @@
+package syncer
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/gsutils"
+	"github.com/chenjianlong/gamesave-sync/pkg/transfer"
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+)
+
+const (
+	// conflictToken marks a snapshot kept aside by resolving a conflict with keep-both,
+	// such a snapshot is never synced to other devices.
+	conflictToken = "conflict"
+	// seqTokenPrefix prefixes the sequence number of a snapshot, see snapshot.Seq
+	seqTokenPrefix = "s"
+	// deviceTokenPrefix prefixes the ID of the device which uploaded a snapshot.
+	deviceTokenPrefix = "d"
+	// hashTokenPrefix prefixes the start of the content hash of a snapshot.
+	hashTokenPrefix = "h"
+	hashTokenLen    = 16
+)
+
+// snapshot is a game save archive in the remote storage, named
+// <game>/<time>[_s<seq>][_d<device>][_h<hash>][_conflict].<ext>.
+// Unknown tokens are ignored, so names written by later versions are still understood.
+type snapshot struct {
+	Name string
+	// Time is the time of the game save by the clock of the uploading device
+	Time time.Time
+	// Seq orders the snapshots, an upload is numbered one more than the snapshots it
+	// follows, so a device with a wrong clock can't reorder them. It's 0 for the snapshots
+	// named before, which are ordered by time.
+	Seq    int64
+	Device string
+	// Hash is the start of the content hash of the game save, see ziputils.Tree.Hash
+	Hash     string
+	Conflict bool
+	Format   ziputils.Format
+	Size     int64
+	// HasMeta is true if the snapshot has a metadata sidecar
+	HasMeta bool
+}
+
+func parseSnapshotName(objName string) (snapshot, bool) {
+	format, err := ziputils.FormatFromName(objName)
+	if err != nil {
+		return snapshot{}, false
+	}
+
+	tokens := strings.Split(strings.TrimSuffix(path.Base(objName), "."+format.Ext()), "_")
+	t, err := time.Parse(gsutils.TimeFormat, tokens[0])
+	if err != nil {
+		return snapshot{}, false
+	}
+
+	s := snapshot{Name: objName, Time: t, Format: format}
+	for _, token := range tokens[1:] {
+		switch {
+		case token == conflictToken:
+			s.Conflict = true
+		case strings.HasPrefix(token, seqTokenPrefix):
+			if seq, err := strconv.ParseInt(strings.TrimPrefix(token, seqTokenPrefix), 10, 64); err == nil {
+				s.Seq = seq
+			}
+		case strings.HasPrefix(token, deviceTokenPrefix):
+			s.Device = strings.TrimPrefix(token, deviceTokenPrefix)
+		case strings.HasPrefix(token, hashTokenPrefix):
+			s.Hash = strings.TrimPrefix(token, hashTokenPrefix)
+		}
+	}
+
+	return s, true
+}
+
+// listSnapshots returns the snapshots of the game in order, the latest last.
+func listSnapshots(t transfer.Transfer, game string) ([]snapshot, error) {
+	var snapshots []snapshot
+	metas := map[string]bool{}
+	for file := range t.ListFileInfo(game + "/") {
+		if file.Err != nil {
+			return nil, fmt.Errorf("failed to list the snapshots of %s: %w", game, file.Err)
+		}
+
+		if strings.HasSuffix(file.Name, metaSuffix) {
+			metas[strings.TrimSuffix(file.Name, metaSuffix)] = true
+			continue
+		}
+
+		s, ok := parseSnapshotName(file.Name)
+		if !ok {
+			log.Printf("Failed to parse time %s\n", file.Name)
+			continue
+		}
+
+		s.Size = file.Size
+		snapshots = append(snapshots, s)
+	}
+
+	for i := range snapshots {
+		snapshots[i].HasMeta = metas[snapshots[i].Name]
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].Seq != snapshots[j].Seq {
+			return snapshots[i].Seq < snapshots[j].Seq
+		}
+
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+
+	return snapshots, nil
+}
+
+// latestSnapshot returns the newest snapshot other devices sync from, nil if there is none.
+func latestSnapshot(snapshots []snapshot) *snapshot {
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if !snapshots[i].Conflict {
+			return &snapshots[i]
+		}
+	}
+
+	return nil
+}
+
+// getObjName returns the remote object name of the snapshot of the game, the extension records
+// the archive format.
+func getObjName(game string, s snapshot) string {
+	tokens := []string{s.Time.UTC().Format(gsutils.TimeFormat)}
+	if s.Seq != 0 {
+		tokens = append(tokens, seqTokenPrefix+strconv.FormatInt(s.Seq, 10))
+	}
+
+	if s.Device != "" {
+		tokens = append(tokens, deviceTokenPrefix+s.Device)
+	}
+
+	if s.Hash != "" {
+		tokens = append(tokens, hashTokenPrefix+s.Hash)
+	}
+
+	if s.Conflict {
+		tokens = append(tokens, conflictToken)
+	}
+
+	return path.Join(game, strings.Join(tokens, "_")+"."+s.Format.Ext())
+}
+
+// hasContent reports whether the snapshot is known to have the content with the hash.
+func (s *snapshot) hasContent(hash string) bool {
+	return s.Hash != "" && hash != "" && strings.HasPrefix(hash, s.Hash)
+}
+
+// nextSeq returns the sequence number of a snapshot uploaded after the snapshots.
+func nextSeq(snapshots []snapshot) int64 {
+	var seq int64
+	for _, s := range snapshots {
+		if s.Seq > seq {
+			seq = s.Seq
+		}
+	}
+
+	return seq + 1
+}
+
+// findSnapshot returns the snapshot referred to by ref, which is either its object name or a
+// unique prefix of its name in the game directory, such as its time.
+func findSnapshot(snapshots []snapshot, ref string) (snapshot, error) {
+	var found []snapshot
+	for _, s := range snapshots {
+		if s.Name == ref {
+			return s, nil
+		}
+
+		if strings.HasPrefix(path.Base(s.Name), ref) {
+			found = append(found, s)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return snapshot{}, fmt.Errorf("snapshot %s is not found", ref)
+	case 1:
+		return found[0], nil
+	default:
+		return snapshot{}, fmt.Errorf("snapshot %s is ambiguous, it matches %d snapshots", ref, len(found))
+	}
+}
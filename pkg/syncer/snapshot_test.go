@@ -0,0 +1,130 @@
+package syncer
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+)
+
+func TestParseSnapshotName(t *testing.T) {
+	at := time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		objName string
+		want    snapshot
+		ok      bool
+	}{
+		{"Game/20240131200000.zip", snapshot{Time: at, Format: ziputils.FormatZip}, true},
+		{"Game/20240131200000_s3_dabc_h0123456789abcdef.tar.zst",
+			snapshot{Time: at, Seq: 3, Device: "abc", Hash: "0123456789abcdef", Format: ziputils.FormatTarZstd}, true},
+		{"Game/20240131200000_s4_conflict.zip", snapshot{Time: at, Seq: 4, Conflict: true, Format: ziputils.FormatZip}, true},
+		// Tokens of later versions are ignored
+		{"Game/20240131200000_s5_xnew.zip", snapshot{Time: at, Seq: 5, Format: ziputils.FormatZip}, true},
+		{"Game/20240131200000.zip.json", snapshot{}, false},
+		{"Game/notatime.zip", snapshot{}, false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseSnapshotName(test.objName)
+		if ok {
+			test.want.Name = test.objName
+		}
+
+		if ok != test.ok || got != test.want {
+			t.Errorf("parseSnapshotName(%q) = %+v, %v, want %+v, %v", test.objName, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestGetObjName(t *testing.T) {
+	at := time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		snap snapshot
+		want string
+	}{
+		{snapshot{Time: at, Format: ziputils.FormatZip}, "Game/20240131200000.zip"},
+		{snapshot{Time: at.In(time.FixedZone("UTC+8", 8*3600)), Seq: 2, Device: "abc", Hash: "0123456789abcdef",
+			Conflict: true, Format: ziputils.FormatTarZstd}, "Game/20240131200000_s2_dabc_h0123456789abcdef_conflict.tar.zst"},
+	}
+
+	for _, test := range tests {
+		got := getObjName("Game", test.snap)
+		if got != test.want {
+			t.Errorf("getObjName() = %q, want %q", got, test.want)
+		}
+
+		parsed, ok := parseSnapshotName(got)
+		if !ok || !parsed.Time.Equal(test.snap.Time) || parsed.Seq != test.snap.Seq || parsed.Device != test.snap.Device ||
+			parsed.Hash != test.snap.Hash || parsed.Conflict != test.snap.Conflict {
+			t.Errorf("parseSnapshotName(%q) = %+v, doesn't round trip %+v", got, parsed, test.snap)
+		}
+	}
+}
+
+// The snapshots are ordered by their sequence numbers, so a device whose clock is ahead doesn't
+// win with its later times.
+func TestSyncGameClockAhead(t *testing.T) {
+	fs := newMemFS()
+	tr := newMemTransfer(fs)
+	a := newFakeDevice(t, fs, tr, "a", Options{})
+	b := newFakeDevice(t, fs, tr, "b", Options{})
+	path := a.savePath("save.sav")
+	fs.writeFile(t, path, "ahead")
+	ahead := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := fs.Chtimes(path, ahead, ahead); err != nil {
+		t.Fatal(err)
+	}
+
+	a.sync(t, outcomeUploaded)
+	b.sync(t, outcomeDownloaded)
+	fs.writeFile(t, b.savePath("save.sav"), "later")
+	b.sync(t, outcomeUploaded)
+	a.sync(t, outcomeDownloaded)
+	if got := fs.readFile(t, path); got != "later" {
+		t.Errorf("save.sav = %q, want %q", got, "later")
+	}
+
+	snapshots, err := listSnapshots(tr, a.info.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latest := latestSnapshot(snapshots); latest.Seq != 2 || !latest.Time.Before(ahead) {
+		t.Errorf("latest snapshot = %s, want the second one with an earlier time", latest.Name)
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	now := time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		serverTime time.Time
+		warn       bool
+	}{
+		{"in sync", now.Add(time.Second), false},
+		{"within limit", now.Add(-maxClockSkew), false},
+		{"ahead", now.Add(-5 * time.Minute), true},
+		{"behind", now.Add(time.Hour), true},
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf.Reset()
+			fs := newMemFS()
+			tr := newMemTransfer(fs)
+			tr.serverTime = test.serverTime
+			a := newFakeDevice(t, fs, tr, "a", Options{})
+			a.CheckClockSkew()
+			if got := strings.Contains(buf.String(), "Warning"); got != test.warn {
+				t.Errorf("warned = %v, want %v: %q", got, test.warn, buf.String())
+			}
+		})
+	}
+}
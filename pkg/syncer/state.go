@@ -0,0 +1,192 @@
+package syncer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+type syncOutcome string
+
+const (
+	outcomeInSync     syncOutcome = "in-sync"
+	outcomeUploaded   syncOutcome = "uploaded"
+	outcomeDownloaded syncOutcome = "downloaded"
+	outcomeConflict   syncOutcome = "conflict"
+	outcomeSkipped    syncOutcome = "skipped"
+	outcomeFailed     syncOutcome = "failed"
+)
+
+// gameState records the syncs of a game on this device.
+type gameState struct {
+	// Snapshot is the remote snapshot the local game save was last uploaded to or restored from.
+	Snapshot string `json:"snapshot,omitempty"`
+	// SaveTime is the modification time of the local game save right after that sync.
+	SaveTime time.Time `json:"saveTime"`
+	// Hash is the content hash of the local game save right after that sync.
+	Hash         string `json:"hash,omitempty"`
+	LastUpload   string `json:"lastUpload,omitempty"`
+	LastDownload string `json:"lastDownload,omitempty"`
+	// LastSync is the time of the last sync, Outcome and Error tell how it went.
+	LastSync time.Time   `json:"lastSync"`
+	Outcome  syncOutcome `json:"outcome"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// synced reports whether the game save was ever uploaded or restored on this device.
+func (g *gameState) synced() bool {
+	return g != nil && g.Snapshot != ""
+}
+
+// syncState is the sync state of every game on this device, it's kept in the app data
+// directory and tells which side of a game save changed since the last sync.
+type syncState struct {
+	mu   sync.Mutex
+	fs   FS
+	path string
+	// Device is the ID of this device, it's recorded in the snapshots uploaded by it
+	Device string                `json:"device,omitempty"`
+	Games  map[string]*gameState `json:"games"`
+	// deviceUnsaved is true if Device is generated but not saved yet
+	deviceUnsaved bool
+}
+
+func loadSyncState(fs FS, appData string) (*syncState, error) {
+	s := &syncState{fs: fs, path: filepath.Join(appData, "state.json"), Games: map[string]*gameState{}}
+	content, err := fs.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(content, s); err != nil {
+		return nil, fmt.Errorf("invalid sync state %s: %w", s.path, err)
+	}
+
+	if s.Games == nil {
+		s.Games = map[string]*gameState{}
+	}
+
+	return s, nil
+}
+
+// get returns the state of the game, nil if it was never synced.
+func (s *syncState) get(game string) *gameState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.Games[game]
+	if !ok {
+		return nil
+	}
+
+	copied := *state
+	return &copied
+}
+
+// games returns the names of the recorded games, sorted.
+func (s *syncState) games() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.Games {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// update changes the state of the game by fn and saves the sync state.
+func (s *syncState) update(game string, fn func(state *gameState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.Games[game]
+	if !ok {
+		state = new(gameState)
+		s.Games[game] = state
+	}
+
+	fn(state)
+	return s.save()
+}
+
+// deviceID returns the ID of this device, it's generated the first time and saved by the next
+// save, see saveDevice.
+func (s *syncState) deviceID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Device == "" {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return "", err
+		}
+
+		s.Device = hex.EncodeToString(id)
+		s.deviceUnsaved = true
+	}
+
+	return s.Device, nil
+}
+
+// saveDevice saves a newly generated device ID, it's called before the ID is recorded remotely.
+func (s *syncState) saveDevice() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.deviceUnsaved {
+		return nil
+	}
+
+	return s.save()
+}
+
+// save writes the sync state, the caller holds the lock.
+func (s *syncState) save() error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(s.fs, s.path, content); err != nil {
+		return err
+	}
+
+	s.deviceUnsaved = false
+	return nil
+}
+
+// PrintStatus prints the recorded last sync of the found games and of the games synced before.
+func (s *Syncer) PrintStatus(w io.Writer, games []GameInfo) error {
+	names := s.state.games()
+	for _, info := range games {
+		if s.state.get(info.Name) == nil {
+			names = append(names, info.Name)
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GAME\tOUTCOME\tLAST SYNC\tLAST UPLOAD\tLAST DOWNLOAD\tERROR")
+	for _, name := range names {
+		g := s.state.get(name)
+		if g == nil {
+			fmt.Fprintf(tw, "%s\tnever synced\t\t\t\t\n", name)
+			continue
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", name, g.Outcome, g.LastSync.Format("2006-01-02 15:04:05"),
+			g.LastUpload, g.LastDownload, g.Error)
+	}
+
+	return tw.Flush()
+}
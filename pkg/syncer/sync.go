@@ -0,0 +1,530 @@
+package syncer
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/i18n"
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+)
+
+type syncAction string
+
+const (
+	actionNone     syncAction = "none"
+	actionUpload   syncAction = "upload"
+	actionDownload syncAction = "download"
+	// actionConflict means the game save changed both locally and remotely since the last sync,
+	// it is left alone until the conflict is resolved.
+	actionConflict syncAction = "conflict"
+	// actionSkip means the direction of the game doesn't allow the action needed, the sync state
+	// is kept so the change is still detected later.
+	actionSkip syncAction = "skip"
+)
+
+// ResolveChoice is how the conflict of a game save changed both locally and remotely is resolved.
+type ResolveChoice string
+
+const (
+	KeepLocal  ResolveChoice = "keep-local"
+	KeepRemote ResolveChoice = "keep-remote"
+	// KeepBoth keeps the newer game save and stores the older one as a conflict snapshot.
+	KeepBoth ResolveChoice = "keep-both"
+)
+
+// lastSync returns the state of the last sync of a game. A game synced before the state was
+// recorded is assumed to be synced from the snapshot which has the content of the local game
+// save, or its time for the snapshots named without content hash.
+func lastSync(state *gameState, saveTime *time.Time, hash string, snapshots []snapshot) *gameState {
+	if state.synced() {
+		return state
+	}
+
+	if saveTime != nil {
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			s := &snapshots[i]
+			if !s.Conflict && (s.hasContent(hash) || (s.Hash == "" && s.Time.Unix() == saveTime.Unix())) {
+				return &gameState{Snapshot: s.Name, SaveTime: *saveTime, Hash: hash}
+			}
+		}
+	}
+
+	return nil
+}
+
+// planSync decides how to sync a game from the local game save, its time and content hash,
+// the latest snapshot, either may be nil, and the last sync. The content hash tells whether the
+// game save changed, the time is only used if the last sync has no hash. The reason of the
+// action is returned too.
+func planSync(saveTime *time.Time, hash string, latest *snapshot, last *gameState) (syncAction, string) {
+	switch {
+	case latest == nil && saveTime == nil:
+		return actionNone, "no game save locally or remotely"
+	case latest == nil:
+		return actionUpload, "no remote game save"
+	case saveTime == nil:
+		return actionDownload, "no local game save"
+	case latest.hasContent(hash):
+		return actionNone, "the local game save is the same as the latest snapshot"
+	case last == nil:
+		return actionConflict, "never synced on this device and the local game save differs from the latest snapshot"
+	}
+
+	localChanged := hash != last.Hash
+	if last.Hash == "" {
+		localChanged = !saveTime.Equal(last.SaveTime)
+	}
+
+	remoteChanged := latest.Name != last.Snapshot
+	switch {
+	case localChanged && remoteChanged:
+		return actionConflict, fmt.Sprintf("changed both locally and remotely in %s since the last sync", path.Base(latest.Name))
+	case localChanged:
+		return actionUpload, "the local game save changed since the last sync"
+	case remoteChanged:
+		return actionDownload, fmt.Sprintf("%s was uploaded since the last sync", path.Base(latest.Name))
+	default:
+		return actionNone, "nothing changed since the last sync"
+	}
+}
+
+// syncPlan is how a game is going to be synced, and what it's decided from.
+type syncPlan struct {
+	action    syncAction
+	reason    string
+	tree      *ziputils.Tree
+	saveTime  *time.Time
+	hash      string
+	snapshots []snapshot
+	latest    *snapshot
+	state     *gameState
+}
+
+// plan scans the local game save and lists the remote snapshots to decide how to sync the game,
+// nothing is changed.
+func (s *Syncer) plan(info GameInfo) (*syncPlan, error) {
+	tree, err := s.scanGameSave(info)
+	if err != nil {
+		return nil, err
+	}
+
+	saveTime := tree.ModTime()
+	hash, err := s.hash(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := listSnapshots(s.transfer, info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := latestSnapshot(snapshots)
+	state := s.state.get(info.Name)
+	action, reason := planSync(saveTime, hash, latest, lastSync(state, saveTime, hash, snapshots))
+	action, reason = info.Direction.restrict(action, reason, saveTime != nil)
+	return &syncPlan{
+		action:    action,
+		reason:    reason,
+		tree:      tree,
+		saveTime:  saveTime,
+		hash:      hash,
+		snapshots: snapshots,
+		latest:    latest,
+		state:     state,
+	}, nil
+}
+
+// SyncGame uploads or downloads the game save, whichever side changed since the last sync.
+// A game save changed on both sides is never overwritten. The outcome is recorded in the sync state.
+func (s *Syncer) SyncGame(info GameInfo) error {
+	outcome, err := s.sync(info)
+	return s.record(info.Name, outcome, err)
+}
+
+// SyncGames syncs the games on jobs workers at the same time, a game which fails to sync doesn't
+// stop the others. A summary of every game is printed to w at the end, and an error is returned
+// if any of them failed.
+func (s *Syncer) SyncGames(w io.Writer, games []GameInfo, jobs int) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	indexCh := make(chan int)
+	errs := make([]error, len(games))
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexCh {
+				info := games[i]
+				log.Println(i18n.GetSyncGameMessage(info.Name))
+				if errs[i] = s.SyncGame(info); errs[i] != nil {
+					log.Printf("Failed to sync %s, err=%s\n", info.Name, errs[i])
+				}
+			}
+		}()
+	}
+
+	for i := range games {
+		indexCh <- i
+	}
+
+	close(indexCh)
+	wg.Wait()
+	return s.printSummary(w, games, errs)
+}
+
+// printSummary prints how every game was synced, errs are the errors of the games.
+func (s *Syncer) printSummary(w io.Writer, games []GameInfo, errs []error) error {
+	failed := 0
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GAME\tOUTCOME\tERROR")
+	for i, info := range games {
+		outcome, message := outcomeFailed, ""
+		if errs[i] != nil {
+			failed++
+			message = errs[i].Error()
+		} else if state := s.state.get(info.Name); state != nil {
+			outcome = state.Outcome
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", info.Name, outcome, message)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d games failed to sync", failed, len(games))
+	}
+
+	return nil
+}
+
+func (s *Syncer) sync(info GameInfo) (syncOutcome, error) {
+	plan, err := s.plan(info)
+	if err != nil {
+		return outcomeFailed, err
+	}
+
+	latest, saveTime, hash, state := plan.latest, plan.saveTime, plan.hash, plan.state
+	log.Printf("Game: %s, action: %s, reason: %s\n", info.Name, plan.action, plan.reason)
+	switch plan.action {
+	case actionUpload:
+		return outcomeUploaded, s.upload(info, plan.tree, nextSeq(plan.snapshots))
+	case actionDownload:
+		return outcomeDownloaded, s.download(info, latest.Name)
+	case actionConflict:
+		meta, err := s.readSnapshotMeta(*latest)
+		if err != nil {
+			return outcomeFailed, err
+		}
+
+		log.Printf("Game save of %s changed both locally and in %s uploaded by %s since the last sync, it is left untouched. "+
+			"Run `gamesave-sync resolve \"%s\" keep-local|keep-remote|keep-both` to resolve the conflict\n",
+			info.Name, latest.Name, meta, info.Name)
+		return outcomeConflict, nil
+	case actionSkip:
+		return outcomeSkipped, nil
+	}
+
+	if saveTime == nil || latest == nil {
+		return outcomeInSync, nil
+	}
+
+	// Record which snapshot the unchanged local game save is in sync with.
+	if state.synced() && state.Snapshot == latest.Name && state.Hash == hash {
+		return outcomeInSync, nil
+	}
+
+	return outcomeInSync, s.state.update(info.Name, func(g *gameState) {
+		g.Snapshot, g.SaveTime, g.Hash = latest.Name, *saveTime, hash
+	})
+}
+
+// PrintPlans prints how every game would be synced and why, without changing anything locally
+// or remotely. An error is returned if the plan of any game failed.
+func (s *Syncer) PrintPlans(w io.Writer, games []GameInfo) error {
+	failed := 0
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GAME\tACTION\tREASON")
+	for _, info := range games {
+		plan, err := s.plan(info)
+		if err != nil {
+			failed++
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", info.Name, outcomeFailed, err)
+			continue
+		}
+
+		action := string(plan.action)
+		if plan.action == actionNone {
+			action = "skip"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", info.Name, action, plan.reason)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to plan %d of %d games", failed, len(games))
+	}
+
+	return nil
+}
+
+// maxClockSkew is the clock skew from the server beyond which a warning is logged.
+const maxClockSkew = 2 * time.Minute
+
+// CheckClockSkew warns if the clock of this device is off the clock of the server, the times of
+// the snapshots uploaded by this device would be off too.
+func (s *Syncer) CheckClockSkew() {
+	serverTime, err := s.transfer.ServerTime()
+	if err != nil {
+		log.Printf("Failed to get the server time, err=%s\n", err)
+		return
+	}
+
+	skew := s.clock.Now().Sub(serverTime)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		log.Printf("Warning: the clock of this device is %s off the server, please check it\n", skew.Round(time.Second))
+	}
+}
+
+// hash returns the content hash of the game save, empty if it has no file. The hash cache
+// is saved when the sync is recorded.
+func (s *Syncer) hash(tree *ziputils.Tree) (string, error) {
+	if tree.ModTime() == nil {
+		return "", nil
+	}
+
+	return tree.Hash(s.fs, s.hashes)
+}
+
+// record saves the outcome of syncing a game and the hash cache, err is returned unless
+// recording fails.
+func (s *Syncer) record(game string, outcome syncOutcome, err error) error {
+	if cacheErr := s.saveHashCache(); cacheErr != nil {
+		log.Printf("Failed to save the hash cache, err=%s\n", cacheErr)
+	}
+
+	recordErr := s.state.update(game, func(g *gameState) {
+		g.LastSync = s.clock.Now()
+		g.Outcome, g.Error = outcome, ""
+		if err != nil {
+			g.Outcome, g.Error = outcomeFailed, err.Error()
+		}
+	})
+
+	if err == nil {
+		err = recordErr
+	} else if recordErr != nil {
+		log.Printf("Failed to record the sync state of %s, err=%s\n", game, recordErr)
+	}
+
+	return err
+}
+
+// ResolveConflict syncs the game save the way chosen by the user, whichever side changed.
+func (s *Syncer) ResolveConflict(info GameInfo, choice ResolveChoice) error {
+	outcome, err := s.resolve(info, choice)
+	return s.record(info.Name, outcome, err)
+}
+
+func (s *Syncer) resolve(info GameInfo, choice ResolveChoice) (syncOutcome, error) {
+	tree, err := s.scanGameSave(info)
+	if err != nil {
+		return outcomeFailed, err
+	}
+
+	saveTime := tree.ModTime()
+	snapshots, err := listSnapshots(s.transfer, info.Name)
+	if err != nil {
+		return outcomeFailed, err
+	}
+
+	latest := latestSnapshot(snapshots)
+	if !info.Direction.uploads() && choice != KeepRemote {
+		return outcomeFailed, fmt.Errorf("%s is %s, only %s is allowed", info.Name, info.Direction, KeepRemote)
+	}
+
+	if saveTime == nil && choice != KeepRemote {
+		return outcomeFailed, fmt.Errorf("no local game save of %s", info.Name)
+	}
+
+	if latest == nil && choice != KeepLocal {
+		return outcomeFailed, fmt.Errorf("no remote game save of %s", info.Name)
+	}
+
+	switch choice {
+	case KeepLocal:
+		return outcomeUploaded, s.upload(info, tree, nextSeq(snapshots))
+	case KeepRemote:
+		return outcomeDownloaded, s.download(info, latest.Name)
+	case KeepBoth:
+		if saveTime.After(latest.Time) {
+			meta, err := s.readSnapshotMeta(*latest)
+			if err != nil {
+				return outcomeFailed, err
+			}
+
+			// A pinned snapshot is kept as it is, it stays in the history behind the local one.
+			if !meta.Pinned {
+				if err = s.moveSnapshot(info, *latest); err != nil {
+					return outcomeFailed, err
+				}
+			}
+
+			return outcomeUploaded, s.upload(info, tree, nextSeq(snapshots))
+		}
+
+		if err := s.uploadConflict(info, tree, latest.Seq); err != nil {
+			return outcomeFailed, err
+		}
+
+		return outcomeDownloaded, s.download(info, latest.Name)
+	default:
+		return outcomeFailed, fmt.Errorf("invalid choice %s, expect %s, %s or %s", choice, KeepLocal, KeepRemote, KeepBoth)
+	}
+}
+
+// upload stores the local game save as the latest snapshot numbered seq.
+func (s *Syncer) upload(info GameInfo, tree *ziputils.Tree, seq int64) error {
+	hash, err := s.hash(tree)
+	if err != nil {
+		return err
+	}
+
+	objName, err := s.uploadSnapshot(info, tree, seq, hash, false)
+	if err != nil {
+		return err
+	}
+
+	err = s.state.update(info.Name, func(g *gameState) {
+		g.Snapshot, g.SaveTime, g.Hash = objName, *tree.ModTime(), hash
+		g.LastUpload = objName
+	})
+
+	if err == nil && s.retention.PruneAfterUpload {
+		if pruneErr := s.Prune(info); pruneErr != nil {
+			log.Printf("Failed to prune %s, err=%s\n", info.Name, pruneErr)
+		}
+	}
+
+	return err
+}
+
+// uploadConflict stores the local game save as a conflict snapshot, the sync state is kept.
+func (s *Syncer) uploadConflict(info GameInfo, tree *ziputils.Tree, seq int64) error {
+	hash, err := s.hash(tree)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.uploadSnapshot(info, tree, seq, hash, true)
+	return err
+}
+
+// uploadSnapshot uploads the local game save as a snapshot of this device together with its
+// metadata, and returns its object name.
+func (s *Syncer) uploadSnapshot(info GameInfo, tree *ziputils.Tree, seq int64, hash string, conflict bool) (string, error) {
+	if err := s.state.saveDevice(); err != nil {
+		return "", err
+	}
+
+	snap := snapshot{
+		Time:     *tree.ModTime(),
+		Seq:      seq,
+		Device:   s.device.ID,
+		Hash:     hash[:hashTokenLen],
+		Conflict: conflict,
+		Format:   info.Archive.Format,
+	}
+	snap.Name = getObjName(info.Name, snap)
+	archivePath, err := s.archivePath(info, snap.Name)
+	if err != nil {
+		return "", err
+	}
+
+	if err = s.uploadGameSave(tree, archivePath, snap.Name, info.Archive); err != nil {
+		return "", err
+	}
+
+	return snap.Name, s.writeSnapshotMeta(snap, newSnapshotMeta(s.device, s.label, s.note))
+}
+
+// download replaces the local game save with the snapshot, the local game save is backed up first.
+func (s *Syncer) download(info GameInfo, objName string) error {
+	if err := s.backupGameSave(info); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", info.Name, err)
+	}
+
+	archivePath, err := s.archivePath(info, objName)
+	if err != nil {
+		return err
+	}
+
+	if err = s.downloadGameSave(info, archivePath, objName); err != nil {
+		return err
+	}
+
+	saveTime, hash, err := s.localGameSave(info)
+	if err != nil {
+		return err
+	}
+
+	return s.state.update(info.Name, func(g *gameState) {
+		g.Snapshot, g.SaveTime, g.Hash = objName, saveTime, hash
+		g.LastDownload = objName
+	})
+}
+
+// localGameSave returns the modification time, zero without any file, and the content hash
+// of the local game save, to record it in the sync state.
+func (s *Syncer) localGameSave(info GameInfo) (time.Time, string, error) {
+	tree, err := s.scanGameSave(info)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	hash, err := s.hash(tree)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	if saveTime := tree.ModTime(); saveTime != nil {
+		return *saveTime, hash, nil
+	}
+
+	return time.Time{}, hash, nil
+}
+
+// moveSnapshot renames the snapshot src to a conflict snapshot together with its metadata,
+// so it's listed once.
+func (s *Syncer) moveSnapshot(info GameInfo, src snapshot) error {
+	dst := src
+	dst.Conflict = true
+	dst.Name = getObjName(info.Name, dst)
+	if err := s.transfer.Rename(src.Name, dst.Name); err != nil {
+		return err
+	}
+
+	if src.HasMeta {
+		if err := s.transfer.Rename(src.Name+metaSuffix, dst.Name+metaSuffix); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Successfully moved %s to %s\n", src.Name, dst.Name)
+	return nil
+}
@@ -0,0 +1,311 @@
+package syncer
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPlanSync(t *testing.T) {
+	saveTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	latest := &snapshot{Name: "Game/20240101120000_s2_h1111111111111111.zip", Hash: "1111111111111111"}
+	tests := []struct {
+		name     string
+		saveTime *time.Time
+		hash     string
+		latest   *snapshot
+		last     *gameState
+		want     syncAction
+	}{
+		{"nothing anywhere", nil, "", nil, nil, actionNone},
+		{"no remote", &saveTime, "2222222222222222aa", nil, nil, actionUpload},
+		{"no local", nil, "", latest, nil, actionDownload},
+		{"same content", &saveTime, "1111111111111111aa", latest, nil, actionNone},
+		{"never synced", &saveTime, "2222222222222222aa", latest, nil, actionConflict},
+		{"local changed", &saveTime, "3333333333333333aa", latest,
+			&gameState{Snapshot: latest.Name, Hash: "2222222222222222aa"}, actionUpload},
+		{"remote changed", &saveTime, "2222222222222222aa", latest,
+			&gameState{Snapshot: "Game/20231231120000_s1.zip", Hash: "2222222222222222aa"}, actionDownload},
+		{"both changed", &saveTime, "3333333333333333aa", latest,
+			&gameState{Snapshot: "Game/20231231120000_s1.zip", Hash: "2222222222222222aa"}, actionConflict},
+		{"nothing changed", &saveTime, "2222222222222222aa", latest,
+			&gameState{Snapshot: latest.Name, Hash: "2222222222222222aa"}, actionNone},
+		{"local changed by time", &saveTime, "2222222222222222aa", latest,
+			&gameState{Snapshot: latest.Name, SaveTime: saveTime.Add(-time.Hour)}, actionUpload},
+		{"unchanged by time", &saveTime, "2222222222222222aa", latest,
+			&gameState{Snapshot: latest.Name, SaveTime: saveTime}, actionNone},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, reason := planSync(test.saveTime, test.hash, test.latest, test.last); got != test.want {
+				t.Errorf("planSync() = %s (%s), want %s", got, reason, test.want)
+			}
+		})
+	}
+}
+
+func TestLastSync(t *testing.T) {
+	saveTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	snapshots := []snapshot{
+		{Name: "Game/20240101120000_s1.zip", Time: saveTime},
+		{Name: "Game/20240102120000_s2_h1111111111111111.zip", Time: saveTime.AddDate(0, 0, 1), Hash: "1111111111111111"},
+		{Name: "Game/20240103120000_s3_h2222222222222222_conflict.zip", Time: saveTime.AddDate(0, 0, 2),
+			Hash: "2222222222222222", Conflict: true},
+	}
+
+	synced := &gameState{Snapshot: "Game/20231231120000.zip"}
+	later := saveTime.Add(time.Minute)
+	tests := []struct {
+		name     string
+		state    *gameState
+		saveTime *time.Time
+		hash     string
+		want     string
+	}{
+		{"recorded", synced, &saveTime, "1111111111111111aa", synced.Snapshot},
+		{"by content", nil, &saveTime, "1111111111111111aa", snapshots[1].Name},
+		{"by time", nil, &saveTime, "3333333333333333aa", snapshots[0].Name},
+		{"conflict skipped", nil, &saveTime, "2222222222222222aa", snapshots[0].Name},
+		{"not found", &gameState{}, &later, "3333333333333333aa", ""},
+		{"no local", nil, nil, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ""
+			if last := lastSync(test.state, test.saveTime, test.hash, snapshots); last != nil {
+				got = last.Snapshot
+			}
+
+			if got != test.want {
+				t.Errorf("lastSync() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSyncGame(t *testing.T) {
+	fs := newMemFS()
+	tr := newMemTransfer(fs)
+	a := newFakeDevice(t, fs, tr, "a", Options{})
+	b := newFakeDevice(t, fs, tr, "b", Options{})
+
+	a.sync(t, outcomeInSync)
+	fs.writeFile(t, a.savePath("save.sav"), "one")
+	a.sync(t, outcomeUploaded)
+	a.sync(t, outcomeInSync)
+	b.sync(t, outcomeDownloaded)
+	if got := fs.readFile(t, b.savePath("save.sav")); got != "one" {
+		t.Errorf("save.sav of b = %q, want %q", got, "one")
+	}
+
+	b.sync(t, outcomeInSync)
+	fs.writeFile(t, b.savePath("save.sav"), "two")
+	b.sync(t, outcomeUploaded)
+	a.sync(t, outcomeDownloaded)
+	if got := fs.readFile(t, a.savePath("save.sav")); got != "two" {
+		t.Errorf("save.sav of a = %q, want %q", got, "two")
+	}
+
+	a.sync(t, outcomeInSync)
+	if got, want := snapshotContents(t, a), []string{"one", "two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshots = %q, want %q", got, want)
+	}
+}
+
+// A game save changed on both sides, or never synced and different from the latest snapshot,
+// is left as a conflict on either side.
+func TestSyncGameThreeWay(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(t *testing.T, fs *memFS, a, b *fakeDevice)
+		want     syncOutcome
+		wantSave string
+		latest   string
+	}{
+		{"nothing changed", func(t *testing.T, fs *memFS, a, b *fakeDevice) {}, outcomeInSync, "one", "one"},
+		{"local changed", func(t *testing.T, fs *memFS, a, b *fakeDevice) {
+			fs.writeFile(t, b.savePath("save.sav"), "b")
+		}, outcomeUploaded, "b", "b"},
+		{"remote changed", func(t *testing.T, fs *memFS, a, b *fakeDevice) {
+			fs.writeFile(t, a.savePath("save.sav"), "a")
+			a.sync(t, outcomeUploaded)
+		}, outcomeDownloaded, "a", "a"},
+		{"both changed", func(t *testing.T, fs *memFS, a, b *fakeDevice) {
+			fs.writeFile(t, a.savePath("save.sav"), "a")
+			a.sync(t, outcomeUploaded)
+			fs.writeFile(t, b.savePath("save.sav"), "b")
+		}, outcomeConflict, "b", "a"},
+		{"both changed, local later", func(t *testing.T, fs *memFS, a, b *fakeDevice) {
+			fs.writeFile(t, b.savePath("save.sav"), "b")
+			fs.writeFile(t, a.savePath("save.sav"), "a")
+			a.sync(t, outcomeUploaded)
+			fs.writeFile(t, b.savePath("save.sav"), "b2")
+		}, outcomeConflict, "b2", "a"},
+		{"both changed the same", func(t *testing.T, fs *memFS, a, b *fakeDevice) {
+			fs.writeFile(t, a.savePath("save.sav"), "same")
+			a.sync(t, outcomeUploaded)
+			fs.writeFile(t, b.savePath("save.sav"), "same")
+		}, outcomeInSync, "same", "same"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := newMemFS()
+			tr := newMemTransfer(fs)
+			a := newFakeDevice(t, fs, tr, "a", Options{})
+			b := newFakeDevice(t, fs, tr, "b", Options{})
+			fs.writeFile(t, a.savePath("save.sav"), "one")
+			a.sync(t, outcomeUploaded)
+			b.sync(t, outcomeDownloaded)
+
+			test.change(t, fs, a, b)
+			b.sync(t, test.want)
+			if got := fs.readFile(t, b.savePath("save.sav")); got != test.wantSave {
+				t.Errorf("save.sav = %q, want %q", got, test.wantSave)
+			}
+
+			contents := snapshotContents(t, b)
+			if got := contents[len(contents)-1]; got != test.latest {
+				t.Errorf("latest snapshot = %q, want %q", got, test.latest)
+			}
+
+			// A conflict stays until it's resolved.
+			if test.want == outcomeConflict {
+				b.sync(t, outcomeConflict)
+			}
+		})
+	}
+}
+
+// A device which has never synced the game keeps its own game save unless it's the same as the
+// latest snapshot.
+func TestSyncGameNeverSynced(t *testing.T) {
+	for _, content := range []string{"one", "other"} {
+		t.Run(content, func(t *testing.T) {
+			fs := newMemFS()
+			tr := newMemTransfer(fs)
+			a := newFakeDevice(t, fs, tr, "a", Options{})
+			b := newFakeDevice(t, fs, tr, "b", Options{})
+			fs.writeFile(t, a.savePath("save.sav"), "one")
+			a.sync(t, outcomeUploaded)
+
+			fs.writeFile(t, b.savePath("save.sav"), content)
+			if content == "one" {
+				b.sync(t, outcomeInSync)
+			} else {
+				b.sync(t, outcomeConflict)
+			}
+
+			if got := fs.readFile(t, b.savePath("save.sav")); got != content {
+				t.Errorf("save.sav = %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+// newConflict returns two devices whose game saves changed since they synced, a uploaded "a"
+// and b is left with "b" in conflict. The game save of b is changed first if bFirst.
+func newConflict(t *testing.T, bFirst bool) (*fakeDevice, *fakeDevice) {
+	fs := newMemFS()
+	tr := newMemTransfer(fs)
+	a := newFakeDevice(t, fs, tr, "a", Options{})
+	b := newFakeDevice(t, fs, tr, "b", Options{})
+	fs.writeFile(t, a.savePath("save.sav"), "one")
+	a.sync(t, outcomeUploaded)
+	b.sync(t, outcomeDownloaded)
+	if bFirst {
+		fs.writeFile(t, b.savePath("save.sav"), "b")
+		fs.writeFile(t, a.savePath("save.sav"), "a")
+	} else {
+		fs.writeFile(t, a.savePath("save.sav"), "a")
+		fs.writeFile(t, b.savePath("save.sav"), "b")
+	}
+
+	a.sync(t, outcomeUploaded)
+	b.sync(t, outcomeConflict)
+	if got := fs.readFile(t, b.savePath("save.sav")); got != "b" {
+		t.Fatalf("save.sav of b in conflict = %q, want %q", got, "b")
+	}
+
+	return a, b
+}
+
+func TestResolveConflict(t *testing.T) {
+	tests := []struct {
+		name      string
+		choice    ResolveChoice
+		bFirst    bool
+		want      syncOutcome
+		wantSave  string
+		snapshots []string
+	}{
+		{"keep local", KeepLocal, false, outcomeUploaded, "b", []string{"a", "b", "one"}},
+		{"keep remote", KeepRemote, false, outcomeDownloaded, "a", []string{"a", "one"}},
+		{"keep both, local newer", KeepBoth, false, outcomeUploaded, "b", []string{"a!", "b", "one"}},
+		{"keep both, remote newer", KeepBoth, true, outcomeDownloaded, "a", []string{"a", "b!", "one"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := newConflict(t, test.bFirst)
+			if err := b.ResolveConflict(b.info, test.choice); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := b.state.get(b.info.Name).Outcome; got != test.want {
+				t.Errorf("ResolveConflict() outcome = %s, want %s", got, test.want)
+			}
+
+			if got := b.fs.readFile(t, b.savePath("save.sav")); got != test.wantSave {
+				t.Errorf("save.sav of b = %q, want %q", got, test.wantSave)
+			}
+
+			snapshots := snapshotContents(t, b)
+			sort.Strings(snapshots)
+			if !reflect.DeepEqual(snapshots, test.snapshots) {
+				t.Errorf("snapshots = %q, want %q", snapshots, test.snapshots)
+			}
+
+			// The metadata is kept with every snapshot, the moved one too.
+			if objects := b.transfer.(*memTransfer).objects; len(objects) != 2*len(snapshots) {
+				t.Errorf("%d objects, want the %d snapshots and their metadata", len(objects), len(snapshots))
+			}
+
+			// Both devices end up with the latest snapshot.
+			b.sync(t, outcomeInSync)
+			if test.want == outcomeUploaded {
+				a.sync(t, outcomeDownloaded)
+			} else {
+				a.sync(t, outcomeInSync)
+			}
+		})
+	}
+}
+
+// Keeping both sides leaves a pinned latest snapshot as it is, behind the local game save.
+func TestResolveConflictKeepsPinned(t *testing.T) {
+	_, b := newConflict(t, false)
+	if err := b.SetPinned(b.info, "~0", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.ResolveConflict(b.info, KeepBoth); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := snapshotContents(t, b), []string{"one", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshots = %q, want %q", got, want)
+	}
+
+	listings, err := b.ListGame(b.info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pinned := listings[1]; !pinned.Pinned || pinned.Conflict {
+		t.Errorf("snapshot %s is pinned %v, conflict %v, want a pinned one", pinned.Name, pinned.Pinned, pinned.Conflict)
+	}
+}
@@ -0,0 +1,185 @@
+// Package syncer syncs the game saves of this device with a remote storage. It reaches the
+// filesystem, the clock, the processes and the remote storage through interfaces, so it runs
+// on any platform and with fakes of them.
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chenjianlong/gamesave-sync/pkg/transfer"
+	"github.com/chenjianlong/gamesave-sync/pkg/ziputils"
+)
+
+// Version is recorded in the uploaded snapshots, it's set at build time by
+// -ldflags "-X github.com/chenjianlong/gamesave-sync/pkg/syncer.Version=<version>".
+var Version = "dev"
+
+// Component is one save location of a game, its Name is empty if the game has only one.
+type Component struct {
+	Name   string
+	Dir    string
+	Filter *ziputils.Filter
+}
+
+// GameInfo is a game found on this device and how its game save is synced.
+type GameInfo struct {
+	Name       string
+	Components []Component
+	ProcName   string
+	Archive    ziputils.Options
+	Retention  *RetentionRule
+	Enabled    bool
+	Devices    []string
+	Direction  Direction
+}
+
+// Clock tells the time of this device.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the clock of the operating system.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Options configures a Syncer, FS, Clock and Processes default to the ones of the operating system.
+type Options struct {
+	// Transfer is the remote storage, it's only required by the methods which use it
+	Transfer  transfer.Transfer
+	FS        FS
+	Clock     Clock
+	Processes ProcessLister
+	// AppData is the existing directory of the sync state, the hash cache, the backups and the
+	// temporary files
+	AppData   string
+	Limits    ziputils.Limits
+	Backup    BackupPolicy
+	Retention RetentionPolicy
+	// DeviceName is the friendly name of this device recorded in the snapshots, defaults to Hostname
+	DeviceName string
+	Hostname   string
+}
+
+// Syncer syncs the game saves of this device with the remote storage.
+type Syncer struct {
+	transfer  transfer.Transfer
+	fs        FS
+	clock     Clock
+	processes ProcessLister
+	appData   string
+	limits    ziputils.Limits
+	backup    BackupPolicy
+	retention RetentionPolicy
+	device    DeviceInfo
+	state     *syncState
+	hashes    *ziputils.HashCache
+	// hashesMu keeps the games synced concurrently from saving the hash cache at the same time
+	hashesMu sync.Mutex
+	// label and note are set to the snapshots uploaded
+	label string
+	note  string
+}
+
+// New returns a Syncer which keeps its state in the app data directory, nothing is written
+// until a game is synced. See RecoverRestores for the restores interrupted by the last run.
+func New(opts Options) (*Syncer, error) {
+	s := &Syncer{
+		transfer:  opts.Transfer,
+		fs:        opts.FS,
+		clock:     opts.Clock,
+		processes: opts.Processes,
+		appData:   opts.AppData,
+		limits:    opts.Limits,
+		backup:    opts.Backup,
+		retention: opts.Retention,
+	}
+
+	if s.fs == nil {
+		s.fs = OSFS{}
+	}
+
+	if s.clock == nil {
+		s.clock = SystemClock{}
+	}
+
+	if s.processes == nil {
+		s.processes = PSProcessLister{}
+	}
+
+	var err error
+	if s.state, err = loadSyncState(s.fs, s.appData); err != nil {
+		return nil, err
+	}
+
+	if s.hashes, err = s.loadHashCache(); err != nil {
+		return nil, err
+	}
+
+	id, err := s.state.deviceID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.device = DeviceInfo{ID: id, Name: opts.DeviceName, Hostname: opts.Hostname}
+	if s.device.Name == "" {
+		s.device.Name = opts.Hostname
+	}
+
+	return s, nil
+}
+
+// SetTransfer sets the remote storage.
+func (s *Syncer) SetTransfer(t transfer.Transfer) {
+	s.transfer = t
+}
+
+// SetUploadLabel sets the label and the note of the snapshots uploaded from now on, empty ones
+// upload snapshots without them.
+func (s *Syncer) SetUploadLabel(label, note string) {
+	s.label = label
+	s.note = note
+}
+
+// Device returns the identity of this device.
+func (s *Syncer) Device() DeviceInfo {
+	return s.device
+}
+
+func (s *Syncer) hashCachePath() string {
+	return filepath.Join(s.appData, "hashcache.json")
+}
+
+// loadHashCache reads the hash cache, it's empty if it's never saved.
+func (s *Syncer) loadHashCache() (*ziputils.HashCache, error) {
+	path := s.hashCachePath()
+	content, err := s.fs.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	cache, err := ziputils.DecodeHashCache(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash cache %s: %w", path, err)
+	}
+
+	return cache, nil
+}
+
+func (s *Syncer) saveHashCache() error {
+	s.hashesMu.Lock()
+	defer s.hashesMu.Unlock()
+	content, err := s.hashes.Encode()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.fs, s.hashCachePath(), content)
+}
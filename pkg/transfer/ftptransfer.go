@@ -1,33 +1,80 @@
 package transfer
 
 import (
+	"bytes"
+	"errors"
 	"github.com/jlaffaye/ftp"
 	"io"
+	"net/textproto"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 )
 
+// FTPTransfer keeps a pool of logged in connections, one for each concurrent operation, since
+// an FTP connection runs one command at a time.
 type FTPTransfer struct {
-	conn     *ftp.ServerConn
-	subDir string
+	addr     string
+	user     string
+	password string
+	subDir   string
+	mu       sync.Mutex
+	idle     []*ftp.ServerConn
 }
 
 func NewFTPTransfer(addr, user, password, subDir string) (Transfer, error) {
-	conn, err := ftp.Dial(addr, ftp.DialWithTimeout(5*time.Second))
+	transfer := new(FTPTransfer)
+	transfer.addr = addr
+	transfer.user = user
+	transfer.password = password
+	transfer.subDir = subDir
+	// Fail early if the server can't be logged in.
+	conn, err := transfer.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	transfer.release(conn, nil)
+	return transfer, nil
+}
+
+// acquire returns an idle connection, or a new one if there is none.
+func (t *FTPTransfer) acquire() (*ftp.ServerConn, error) {
+	t.mu.Lock()
+	if n := len(t.idle); n > 0 {
+		conn := t.idle[n-1]
+		t.idle = t.idle[:n-1]
+		t.mu.Unlock()
+		return conn, nil
+	}
+
+	t.mu.Unlock()
+	conn, err := ftp.Dial(t.addr, ftp.DialWithTimeout(5*time.Second))
 	if err != nil {
 		return nil, err
 	}
 
-	if err = conn.Login(user, password); err != nil {
+	if err = conn.Login(t.user, t.password); err != nil {
+		conn.Quit()
 		return nil, err
 	}
 
-	transfer := new(FTPTransfer)
-	transfer.conn = conn
-	transfer.subDir = subDir
-	return transfer, nil
+	return conn, nil
+}
+
+// release puts the connection back to the pool, it's closed instead if the operation on it
+// failed since the connection may be broken.
+func (t *FTPTransfer) release(conn *ftp.ServerConn, err error) {
+	if err != nil {
+		conn.Quit()
+		return
+	}
+
+	t.mu.Lock()
+	t.idle = append(t.idle, conn)
+	t.mu.Unlock()
 }
 
 func (t *FTPTransfer) Upload(localFile, remoteFile string) error {
@@ -37,18 +84,24 @@ func (t *FTPTransfer) Upload(localFile, remoteFile string) error {
 	}
 	defer fs.Close()
 
+	conn, err := t.acquire()
+	if err != nil {
+		return err
+	}
+	defer func() { t.release(conn, err) }()
+
 	remoteFile = path.Join(t.subDir, remoteFile)
-	err = t.conn.Stor(remoteFile, fs)
+	err = conn.Stor(remoteFile, fs)
 	if err != nil && err.Error() == "550 Couldn't open the file or directory" {
 		elements := strings.Split(remoteFile, "/")
 		for i := 1; i < len(elements); i += 1 {
 			remoteDir := path.Join(elements[:i]...)
-			if err = t.conn.MakeDir(remoteDir); err != nil {
+			if err = conn.MakeDir(remoteDir); err != nil {
 				return err
 			}
 		}
 
-		err = t.conn.Stor(remoteFile, fs)
+		err = conn.Stor(remoteFile, fs)
 	}
 
 	return err
@@ -59,25 +112,48 @@ func (t *FTPTransfer) Download(remoteFile, localFile string) error {
 	if err != nil {
 		return err
 	}
+	defer fs.Close()
+
+	conn, err := t.acquire()
+	if err != nil {
+		return err
+	}
+	defer func() { t.release(conn, err) }()
 
 	remoteFile = path.Join(t.subDir, remoteFile)
-	resp, err := t.conn.Retr(remoteFile)
+	resp, err := conn.Retr(remoteFile)
 	if err != nil {
 		return err
 	}
 
-	defer resp.Close()
 	_, err = io.Copy(fs, resp)
+	if closeErr := resp.Close(); err == nil {
+		err = closeErr
+	}
+
 	return err
 }
 
-func (t *FTPTransfer) ListFile(dir string) chan string {
-	resultCh := make(chan string)
+func (t *FTPTransfer) ListFileInfo(dir string) chan FileInfo {
+	resultCh := make(chan FileInfo)
 	go func() {
-		dir = path.Join(t.subDir, dir)
-		entries, err := t.conn.List(dir)
+		defer close(resultCh)
+		conn, err := t.acquire()
+		if err != nil {
+			resultCh <- FileInfo{Err: err}
+			return
+		}
+
+		entries, err := conn.List(path.Join(t.subDir, dir))
+		if isNotFound(err) {
+			// The directory isn't created until the first upload
+			t.release(conn, nil)
+			return
+		}
+
+		t.release(conn, err)
 		if err != nil {
-			close(resultCh)
+			resultCh <- FileInfo{Err: err}
 			return
 		}
 
@@ -86,9 +162,66 @@ func (t *FTPTransfer) ListFile(dir string) chan string {
 				continue
 			}
 
-			resultCh <- entry.Name
+			// Same as S3, the names are relative to the root rather than to dir
+			resultCh <- FileInfo{path.Join(dir, entry.Name), int64(entry.Size), nil}
 		}
-		close(resultCh)
 	}()
 	return resultCh
 }
+
+// isNotFound reports whether err is the reply of the server to a file or directory which
+// doesn't exist, most servers reply 550 and some 450.
+func isNotFound(err error) bool {
+	var protoErr *textproto.Error
+	if !errors.As(err, &protoErr) {
+		return false
+	}
+
+	msg := strings.ToLower(protoErr.Msg)
+	return protoErr.Code == ftp.StatusFileUnavailable ||
+		(protoErr.Code == ftp.StatusFileActionIgnored && (strings.Contains(msg, "not found") || strings.Contains(msg, "no such")))
+}
+
+func (t *FTPTransfer) Remove(remoteFile string) error {
+	conn, err := t.acquire()
+	if err != nil {
+		return err
+	}
+
+	err = conn.Delete(path.Join(t.subDir, remoteFile))
+	t.release(conn, err)
+	return err
+}
+
+func (t *FTPTransfer) Rename(src, dst string) error {
+	conn, err := t.acquire()
+	if err != nil {
+		return err
+	}
+
+	err = conn.Rename(path.Join(t.subDir, src), path.Join(t.subDir, dst))
+	t.release(conn, err)
+	return err
+}
+
+// ServerTime stores an empty probe file and returns its modification time by MDTM.
+func (t *FTPTransfer) ServerTime() (time.Time, error) {
+	conn, err := t.acquire()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer func() { t.release(conn, err) }()
+
+	if !conn.IsGetTimeSupported() {
+		return time.Time{}, errors.New("MDTM is not supported by the server")
+	}
+
+	probe := path.Join(t.subDir, ".gamesave-probe")
+	if err = conn.Stor(probe, bytes.NewReader(nil)); err != nil {
+		return time.Time{}, err
+	}
+	defer conn.Delete(probe)
+
+	serverTime, err := conn.GetTime(probe)
+	return serverTime, err
+}
@@ -2,7 +2,11 @@ package transfer
 
 import (
 	"context"
-	. "github.com/chenjianlong/gamesave-sync/pkg/gsutils"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
@@ -28,9 +32,30 @@ func NewS3Transfer(endpoint, bucketName, accessKeyID, secretAccessKey string) (T
 	return transfer, nil
 }
 
+// contentTypes are the content types of the uploaded files by their extensions.
+var contentTypes = []struct {
+	ext         string
+	contentType string
+}{
+	{".zip", "application/zip"},
+	{".tar.zst", "application/zstd"},
+	{".json", "application/json"},
+}
+
+// contentType returns the content type of the file named name, by its extension.
+func contentType(name string) string {
+	for _, t := range contentTypes {
+		if strings.HasSuffix(name, t.ext) {
+			return t.contentType
+		}
+	}
+
+	return "application/octet-stream"
+}
+
 func (t *S3Transfer) Upload(localFile, remoteFile string) error {
 	_, err := t.client.FPutObject(context.Background(), t.bucketName, remoteFile, localFile, minio.PutObjectOptions{
-		ContentType: "application/zip",
+		ContentType: contentType(remoteFile),
 	})
 
 	return err
@@ -40,19 +65,48 @@ func (t *S3Transfer) Download(remoteFile, localFile string) error {
 	return t.client.FGetObject(context.Background(), t.bucketName, remoteFile, localFile, minio.GetObjectOptions{})
 }
 
-func (t *S3Transfer) ListFile(dir string) chan string {
+func (t *S3Transfer) ListFileInfo(dir string) chan FileInfo {
 	objectCh := t.client.ListObjects(context.Background(), t.bucketName, minio.ListObjectsOptions{Prefix: dir, Recursive: true})
-	resultCh := make(chan string)
+	resultCh := make(chan FileInfo)
 	go func() {
 		for obj := range objectCh {
-			CheckError(obj.Err)
-			resultCh <- obj.Key
+			if obj.Err != nil {
+				resultCh <- FileInfo{Err: obj.Err}
+				break
+			}
+
+			resultCh <- FileInfo{obj.Key, obj.Size, nil}
 		}
 		close(resultCh)
 	}()
 	return resultCh
 }
 
+func (t *S3Transfer) Remove(remoteFile string) error {
+	return t.client.RemoveObject(context.Background(), t.bucketName, remoteFile, minio.RemoveObjectOptions{})
+}
+
+// serverTimeTimeout bounds the request for the server time, so an unreachable endpoint doesn't
+// hold up the sync.
+const serverTimeTimeout = 10 * time.Second
+
+// ServerTime returns the Date header of a HEAD request to the endpoint.
+func (t *S3Transfer) ServerTime() (time.Time, error) {
+	client := http.Client{Timeout: serverTimeTimeout}
+	resp, err := client.Head(t.client.EndpointURL().String())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	resp.Body.Close()
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return time.Time{}, fmt.Errorf("no Date header from %s", t.client.EndpointURL())
+	}
+
+	return http.ParseTime(date)
+}
+
 func (t *S3Transfer) Rename(src, dst string) error {
 	srcOpt := minio.CopySrcOptions{
 		Bucket: t.bucketName,
@@ -60,7 +114,7 @@ func (t *S3Transfer) Rename(src, dst string) error {
 	}
 
 	dstOpt := minio.CopyDestOptions{
-		Bucket:  t.bucketName,
+		Bucket: t.bucketName,
 		Object: dst,
 	}
 
@@ -69,4 +123,4 @@ func (t *S3Transfer) Rename(src, dst string) error {
 	}
 
 	return t.client.RemoveObject(context.Background(), t.bucketName, src, minio.RemoveObjectOptions{})
-}
\ No newline at end of file
+}
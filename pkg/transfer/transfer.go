@@ -1,5 +1,7 @@
 package transfer
 
+import "time"
+
 type Uploader interface {
 	Upload(localFile, remoteFile string) error
 }
@@ -8,8 +10,21 @@ type Downloader interface {
 	Download(remoteFile, localFile string) error
 }
 
+// FileInfo describes a remote file, Name is relative to the root like the names passed to Upload.
+// Err is set instead if the listing failed, it's the last one listed.
+type FileInfo struct {
+	Name string
+	Size int64
+	Err  error
+}
+
 type Transfer interface {
 	Uploader
 	Downloader
-	ListFile(dir string) chan string
+	ListFileInfo(dir string) chan FileInfo
+	Remove(remoteFile string) error
+	// Rename moves the remote file src to dst.
+	Rename(src, dst string) error
+	// ServerTime returns the current time of the server, to detect the clock skew of this device.
+	ServerTime() (time.Time, error)
 }
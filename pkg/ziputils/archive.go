@@ -0,0 +1,535 @@
+package ziputils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatZip      Format = "zip"
+	FormatZipStore Format = "zip-store"
+	FormatTarZstd  Format = "tar.zst"
+)
+
+// Options describes how an archive is written.
+type Options struct {
+	Format Format
+	// Level is the compression level of the format, 0 means the default level.
+	Level int
+	// Filter selects the archived files, nil means everything under the source.
+	Filter *Filter
+}
+
+// Ext returns the file extension, without leading dot, used for archives of the format.
+// Both zip formats share the same extension since one reader handles them.
+func (f Format) Ext() string {
+	switch f {
+	case FormatTarZstd:
+		return "tar.zst"
+	default:
+		return "zip"
+	}
+}
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", FormatZip:
+		return FormatZip, nil
+	case FormatZipStore, FormatTarZstd:
+		return Format(s), nil
+	default:
+		return "", fmt.Errorf("invalid archive format: %s", s)
+	}
+}
+
+// FormatFromName returns the format of the archive by its file or object name.
+func FormatFromName(name string) (Format, error) {
+	switch {
+	case strings.HasSuffix(name, "."+FormatTarZstd.Ext()):
+		return FormatTarZstd, nil
+	case strings.HasSuffix(name, "."+FormatZip.Ext()):
+		return FormatZip, nil
+	default:
+		return "", fmt.Errorf("unknown archive format: %s", name)
+	}
+}
+
+// TrimExt removes the archive extension from name, ok is false if name is not an archive.
+func TrimExt(name string) (string, bool) {
+	format, err := FormatFromName(name)
+	if err != nil {
+		return name, false
+	}
+
+	return strings.TrimSuffix(name, "."+format.Ext()), true
+}
+
+type archiveWriter interface {
+	// writeFile streams the content of a file into the archive.
+	writeFile(entry *ManifestEntry, r io.Reader) error
+	// prepareFile compresses the content of a file ahead of writing it, it is called
+	// concurrently and the result is passed to writePrepared in archive order.
+	prepareFile(entry *ManifestEntry, content []byte) (interface{}, error)
+	writePrepared(entry *ManifestEntry, prepared interface{}) error
+	Close() error
+}
+
+type archiveEntry struct {
+	name    string
+	mode    os.FileMode
+	modTime time.Time
+	size    int64
+	open    func() (io.ReadCloser, error)
+	// concurrent is true if open may be called from another goroutine after next
+	// returns, otherwise the content must be read before the next entry.
+	concurrent bool
+}
+
+type archiveReader interface {
+	// next returns io.EOF after the last entry.
+	next() (*archiveEntry, error)
+	Close() error
+}
+
+// indexedArchiveReader is an archiveReader which knows every entry up front, like zip.
+type indexedArchiveReader interface {
+	archiveReader
+	// index returns the number of entries and their total declared size.
+	index() (int, int64)
+}
+
+func newArchiveWriter(w io.Writer, opts Options) (archiveWriter, error) {
+	switch opts.Format {
+	case "", FormatZip, FormatZipStore:
+		return newZipArchiveWriter(w, opts)
+	case FormatTarZstd:
+		return newTarZstdArchiveWriter(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid archive format: %s", opts.Format)
+	}
+}
+
+func openArchiveReader(fs FS, source string) (archiveReader, error) {
+	format, err := FormatFromName(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == FormatTarZstd {
+		return openTarZstdArchiveReader(fs, source)
+	}
+
+	return openZipArchiveReader(fs, source)
+}
+
+// Files larger than this are streamed by the writing goroutine instead of being
+// read and compressed into memory by the workers.
+const largeFileSize = 32 << 20
+
+// Archive packs every regular file and directory under source selected by the filter
+// of opts into destination, together with a manifest describing them.
+func Archive(fs FS, source, destination string, opts Options) error {
+	tree, err := Scan(fs, source, opts.Filter)
+	if err != nil {
+		return err
+	}
+
+	return ArchiveTree(fs, tree, destination, opts)
+}
+
+// ArchiveTree packs the files and directories of a scanned tree into destination, together
+// with a manifest describing them. The files are compressed in parallel and written in order.
+func ArchiveTree(fs FS, tree *Tree, destination string, opts Options) (err error) {
+	file, err := fs.OpenFile(destination, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	aw, err := newArchiveWriter(file, opts)
+	if err != nil {
+		return err
+	}
+
+	manifest := &Manifest{Version: manifestVersion, Entries: tree.Entries}
+	err = writeFiles(fs, aw, manifest.Entries, tree.paths)
+	if err == nil {
+		err = writeManifest(aw, manifest)
+	}
+
+	if closeErr := aw.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+type fileJob struct {
+	entry    *ManifestEntry
+	path     string
+	prepared interface{}
+	err      error
+	done     chan struct{}
+}
+
+func (job *fileJob) prepare(fs FS, aw archiveWriter) {
+	defer close(job.done)
+	if job.entry.Size > largeFileSize {
+		return
+	}
+
+	content, err := readFile(fs, job.path)
+	if err != nil {
+		job.err = err
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	job.entry.Size = int64(len(content))
+	job.entry.SHA256 = hex.EncodeToString(sum[:])
+	job.prepared, job.err = aw.prepareFile(job.entry, content)
+}
+
+// writeFiles fills in the size and hash of the file entries while writing them.
+func writeFiles(fs FS, aw archiveWriter, entries []ManifestEntry, paths []string) error {
+	var jobs []*fileJob
+	for i := range entries {
+		if entries[i].Dir {
+			continue
+		}
+
+		jobs = append(jobs, &fileJob{
+			entry: &entries[i],
+			path:  paths[i],
+			done:  make(chan struct{}),
+		})
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	pool := newWorkerPool(workers)
+	// Bounds the prepared files kept in memory waiting for their turn to be written.
+	tokens := make(chan struct{}, workers*2)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		defer pool.wait()
+		for _, job := range jobs {
+			select {
+			case tokens <- struct{}{}:
+			case <-stop:
+				return
+			}
+
+			job := job
+			// prepare keeps its error in the job, so the pool never stops on it
+			_ = pool.submit(func() error {
+				job.prepare(fs, aw)
+				return nil
+			})
+		}
+	}()
+
+	for _, job := range jobs {
+		<-job.done
+		err := job.err
+		if err == nil {
+			if job.prepared != nil {
+				err = aw.writePrepared(job.entry, job.prepared)
+			} else {
+				err = addFile(fs, aw, job.entry, job.path)
+			}
+		}
+
+		job.prepared = nil
+		<-tokens
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addFile(fs FS, aw archiveWriter, entry *ManifestEntry, path string) error {
+	file, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if err = aw.writeFile(entry, io.TeeReader(file, hash)); err != nil {
+		return err
+	}
+
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// Destinations maps the top level directories of an archive to the directories they are
+// extracted to, the entries outside of them are extracted to the "" destination.
+type Destinations map[string]string
+
+// destination returns the name of the destination of an entry and its path relative to it.
+func (d Destinations) destination(name string) (string, string, error) {
+	elements := strings.SplitN(name, "/", 2)
+	if _, ok := d[elements[0]]; ok && elements[0] != "" {
+		rel := ""
+		if len(elements) == 2 {
+			rel = elements[1]
+		}
+
+		return elements[0], rel, nil
+	}
+
+	if _, ok := d[""]; ok {
+		return "", name, nil
+	}
+
+	return "", "", fmt.Errorf("no destination for %s", name)
+}
+
+// resolve returns the path an entry is extracted to.
+func (d Destinations) resolve(name string) (string, error) {
+	destination, rel, err := d.destination(name)
+	if err != nil {
+		return "", err
+	}
+
+	return entryPath(d[destination], rel)
+}
+
+// ExtractOptions describes how an archive is extracted.
+type ExtractOptions struct {
+	Limits Limits
+	// Reserve is called with the name of the destination and the size declared by the header of
+	// every file before the file is written, an error stops extracting. nil reserves nothing.
+	Reserve func(destination string, size int64) error
+}
+
+// Extract unpacks source into destination, the extractor is chosen by the extension of source.
+func Extract(fs FS, source, destination string, limits Limits) error {
+	_, err := ExtractTo(fs, source, Destinations{"": destination}, ExtractOptions{Limits: limits})
+	return err
+}
+
+// ExtractTo unpacks source into the destinations of its top level directories, and returns the
+// names of the top level files and directories of the archive, including the empty ones recorded
+// in its manifest. If the archive has a manifest, every extracted file is validated against it
+// and the directories, permissions and modification times recorded in it are restored.
+// Extracting fails as soon as the archive breaks the limits or has an entry which is neither
+// a regular file nor a directory. Files are written in parallel.
+func ExtractTo(fs FS, source string, destinations Destinations, opts ExtractOptions) (map[string]bool, error) {
+	info, err := fs.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := openArchiveReader(fs, source)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	absDestinations := Destinations{}
+	for name, dir := range destinations {
+		if absDestinations[name], err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+	}
+	destinations = absDestinations
+
+	guard := &extractGuard{limits: opts.Limits, archiveSize: info.Size()}
+	if indexed, ok := reader.(indexedArchiveReader); ok {
+		if err = guard.checkIndex(indexed.index()); err != nil {
+			return nil, err
+		}
+	}
+
+	names := map[string]bool{}
+
+	var manifest *Manifest
+	var mu sync.Mutex
+	extracted := map[string]string{}
+	pool := newWorkerPool(runtime.GOMAXPROCS(0))
+	extract := func(entry *archiveEntry) error {
+		sum, err := extractEntry(fs, entry, destinations)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		extracted[entry.name] = sum
+		mu.Unlock()
+		return nil
+	}
+
+	for {
+		entry, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+
+		if err == nil {
+			err = guard.check(entry)
+		}
+
+		if err == nil && opts.Reserve != nil && entry.mode.IsRegular() && entry.name != ManifestName {
+			var destination string
+			if destination, _, err = destinations.destination(entry.name); err == nil {
+				err = opts.Reserve(destination, entry.size)
+			}
+		}
+
+		if err != nil {
+			pool.wait()
+			return nil, err
+		}
+
+		if entry.name != ManifestName {
+			names[topLevelName(entry.name)] = true
+		}
+
+		switch {
+		case entry.name == ManifestName:
+			manifest, err = readManifest(entry)
+		case entry.mode.IsDir():
+			_, err = extractEntry(fs, entry, destinations)
+		case entry.concurrent:
+			err = pool.submit(func() error { return extract(entry) })
+		case entry.size <= largeFileSize:
+			// Decompress here, so the next entry can be read while the workers write this one.
+			var content []byte
+			if content, err = readEntry(entry); err == nil {
+				entry.open = func() (io.ReadCloser, error) {
+					return ioutil.NopCloser(bytes.NewReader(content)), nil
+				}
+
+				err = pool.submit(func() error { return extract(entry) })
+			}
+		default:
+			err = extract(entry)
+		}
+
+		if err != nil {
+			pool.wait()
+			return nil, err
+		}
+	}
+
+	if err = pool.wait(); err != nil {
+		return nil, err
+	}
+
+	if manifest == nil {
+		return names, nil
+	}
+
+	for _, entry := range manifest.Entries {
+		names[topLevelName(entry.Path)] = true
+	}
+
+	return names, manifest.apply(fs, destinations, extracted)
+}
+
+// topLevelName returns the name of the top level file or directory the entry named name is in.
+func topLevelName(name string) string {
+	return strings.SplitN(name, "/", 2)[0]
+}
+
+// readEntry reads the content of the entry into memory, it fails if the content is larger than
+// its header tells.
+func readEntry(entry *archiveEntry) ([]byte, error) {
+	content, err := entry.open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(content, entry.size+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > entry.size {
+		return nil, fmt.Errorf("%s is larger than its header tells", entry.name)
+	}
+
+	return data, nil
+}
+
+// entryPath returns the path of the entry under destination, an empty name is destination itself.
+func entryPath(destination, name string) (string, error) {
+	if name == "" {
+		return filepath.Clean(destination), nil
+	}
+
+	// Check if file paths are not vulnerable to Zip Slip
+	filePath := filepath.Join(destination, name)
+	if !strings.HasPrefix(filePath, filepath.Clean(destination)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid file path: %s", filePath)
+	}
+
+	return filePath, nil
+}
+
+// extractEntry writes the entry to its destination and returns the SHA-256 of its content.
+func extractEntry(fs FS, entry *archiveEntry, destinations Destinations) (string, error) {
+	filePath, err := destinations.resolve(entry.name)
+	if err != nil {
+		return "", err
+	}
+
+	if entry.mode.IsDir() {
+		return "", fs.MkdirAll(filePath, os.ModePerm)
+	}
+
+	if err := fs.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return "", err
+	}
+
+	destinationFile, err := fs.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.mode.Perm())
+	if err != nil {
+		return "", err
+	}
+	defer destinationFile.Close()
+
+	content, err := entry.open()
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(destinationFile, hash), content); err != nil {
+		return "", err
+	}
+
+	if err := destinationFile.Close(); err != nil {
+		return "", err
+	}
+
+	if err := fs.Chtimes(filePath, time.Now(), entry.modTime); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,128 @@
+package ziputils
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const (
+	benchFiles    = 64
+	benchFileSize = 1 << 20
+)
+
+// benchFormats are the archive formats benchmarked.
+var benchFormats = []Format{FormatZip, FormatZipStore, FormatTarZstd}
+
+// writeBenchSave writes a game save of benchFiles files under dir, half random and half
+// repeated content, so it compresses about as well as a typical one.
+func writeBenchSave(b *testing.B, dir string) {
+	b.Helper()
+	r := rand.New(rand.NewSource(1))
+	content := make([]byte, benchFileSize)
+	for i := 0; i < benchFiles; i++ {
+		r.Read(content[:benchFileSize/2])
+		for j := benchFileSize / 2; j < benchFileSize; j++ {
+			content[j] = byte(j / 64)
+		}
+
+		path := filepath.Join(dir, "slot"+strconv.Itoa(i%4), "save"+strconv.Itoa(i)+".sav")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			b.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkArchive(b *testing.B) {
+	dir := b.TempDir()
+	save := filepath.Join(dir, "save")
+	writeBenchSave(b, save)
+	for _, format := range benchFormats {
+		b.Run(string(format), func(b *testing.B) {
+			destination := filepath.Join(dir, "save."+format.Ext())
+			b.SetBytes(benchFiles * benchFileSize)
+			for i := 0; i < b.N; i++ {
+				if err := Archive(OSFS{}, save, destination, Options{Format: format}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkExtract(b *testing.B) {
+	dir := b.TempDir()
+	save := filepath.Join(dir, "save")
+	writeBenchSave(b, save)
+	for _, format := range benchFormats {
+		b.Run(string(format), func(b *testing.B) {
+			source := filepath.Join(dir, "save."+format.Ext())
+			if err := Archive(OSFS{}, save, source, Options{Format: format}); err != nil {
+				b.Fatal(err)
+			}
+
+			b.SetBytes(benchFiles * benchFileSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				destination := filepath.Join(dir, "extract"+strconv.Itoa(i))
+				if err := Extract(OSFS{}, source, destination, DefaultLimits); err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				if err := os.RemoveAll(destination); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// BenchmarkZipSource and BenchmarkUnzipSource measure the zip path of the functions which
+// came before Archive and Extract.
+func BenchmarkZipSource(b *testing.B) {
+	dir := b.TempDir()
+	save := filepath.Join(dir, "save")
+	writeBenchSave(b, save)
+	destination := filepath.Join(dir, "save.zip")
+	b.SetBytes(benchFiles * benchFileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ZipSource(save, destination); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnzipSource(b *testing.B) {
+	dir := b.TempDir()
+	save := filepath.Join(dir, "save")
+	writeBenchSave(b, save)
+	source := filepath.Join(dir, "save.zip")
+	if err := ZipSource(save, source); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(benchFiles * benchFileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		destination := filepath.Join(dir, "extract"+strconv.Itoa(i))
+		if err := UnzipSource(source, destination); err != nil {
+			b.Fatal(err)
+		}
+
+		b.StopTimer()
+		if err := os.RemoveAll(destination); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+	}
+}
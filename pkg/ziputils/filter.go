@@ -0,0 +1,148 @@
+package ziputils
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// ignoreCase is set where the file names are case insensitive, the patterns are too.
+const ignoreCase = runtime.GOOS == "windows"
+
+// Filter selects the files of a game save by glob patterns. Patterns are matched against
+// the slash separated path relative to the save directory, a "**" element matches any number
+// of path elements. A pattern without slash also matches any single path element, and a
+// pattern matching a directory matches everything under it, so "*.log" and "ShaderCache"
+// work at any depth. Patterns ignore case on Windows.
+type Filter struct {
+	Include []string
+	Exclude []string
+	// Files limits the game save to the files directly in the save directory matching
+	// one of them, for a game which keeps its save in a few files of a shared directory.
+	Files []string
+}
+
+// NewFilter returns nil if there are no patterns, so the whole directory is selected.
+func NewFilter(include, exclude, files []string) (*Filter, error) {
+	if len(include) == 0 && len(exclude) == 0 && len(files) == 0 {
+		return nil, nil
+	}
+
+	for _, patterns := range [][]string{include, exclude, files} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, pattern := range files {
+		if strings.Contains(pattern, "/") {
+			return nil, fmt.Errorf("file pattern must not contain /: %s", pattern)
+		}
+	}
+
+	return &Filter{include, exclude, files}, nil
+}
+
+// Match reports whether the file or directory with the relative path name is selected.
+func (f *Filter) Match(name string) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Files) != 0 && (strings.Contains(name, "/") || !matchFile(f.Files, name)) {
+		return false
+	}
+
+	if len(f.Include) != 0 && !matchAny(f.Include, name) {
+		return false
+	}
+
+	return !matchAny(f.Exclude, name)
+}
+
+// Excluded reports whether the directory with the relative path name and everything under it
+// is excluded, so walking it can be skipped.
+func (f *Filter) Excluded(name string) bool {
+	return f != nil && (len(f.Files) != 0 || matchAny(f.Exclude, name))
+}
+
+func matchFile(patterns []string, name string) bool {
+	if ignoreCase {
+		name = strings.ToLower(name)
+	}
+
+	for _, pattern := range patterns {
+		if ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchPattern(pattern, name string) bool {
+	if ignoreCase {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+
+	patternElements := strings.Split(pattern, "/")
+	elements := strings.Split(name, "/")
+	for i := range elements {
+		if matchElements(patternElements, elements[:i+1]) {
+			return true
+		}
+
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, elements[i]); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchElements reports whether the path elements match the pattern elements one by one,
+// a "**" pattern element matches any number of path elements.
+func matchElements(pattern, elements []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elements); i++ {
+				if matchElements(pattern[1:], elements[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(elements) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], elements[0]); !ok {
+			return false
+		}
+
+		pattern, elements = pattern[1:], elements[1:]
+	}
+
+	return len(elements) == 0
+}
@@ -0,0 +1,138 @@
+package ziputils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		files   []string
+		path    string
+		want    bool
+	}{
+		{"no pattern", nil, nil, nil, "slot1/save.sav", true},
+		{"name at the top", nil, []string{"*.log"}, nil, "game.log", false},
+		{"name at any depth", nil, []string{"*.log"}, nil, "logs/2024/game.log", false},
+		{"name not matched", nil, []string{"*.log"}, nil, "save.sav", true},
+		{"path from the top", nil, []string{"logs/*.txt"}, nil, "logs/a.txt", false},
+		{"path not at any depth", nil, []string{"logs/*.txt"}, nil, "old/logs/a.txt", true},
+		{"star within an element", nil, []string{"logs/*"}, nil, "logs/2024/a.txt", false},
+		{"excluded directory", nil, []string{"ShaderCache"}, nil, "ShaderCache/a.bin", false},
+		{"nested excluded directory", nil, []string{"ShaderCache"}, nil, "gpu/ShaderCache/a.bin", false},
+		{"double star at the top", nil, []string{"**/cache/*.bin"}, nil, "cache/a.bin", false},
+		{"double star at depth", nil, []string{"**/cache/*.bin"}, nil, "x/y/cache/a.bin", false},
+		{"double star not matched", nil, []string{"**/cache/*.bin"}, nil, "x/cache/keep.txt", true},
+		{"double star in the middle", nil, []string{"saves/**/*.bak"}, nil, "saves/a/b/c.bak", false},
+		{"double star in the middle, no element", nil, []string{"saves/**/*.bak"}, nil, "saves/c.bak", false},
+		{"double star at the end", []string{"saves/**"}, nil, nil, "saves/slot1/a.sav", true},
+		{"double star at the end, outside", []string{"saves/**"}, nil, nil, "other.sav", false},
+		{"included", []string{"*.sav"}, nil, nil, "slot1/a.sav", true},
+		{"not included", []string{"*.sav"}, nil, nil, "a.txt", false},
+		{"included then excluded", []string{"*.sav"}, []string{"backup*"}, nil, "backup1.sav", false},
+		{"included then excluded directory", []string{"*.sav"}, []string{"backup*"}, nil, "backups/a.sav", false},
+		{"included, not excluded", []string{"*.sav"}, []string{"backup*"}, nil, "slot1.sav", true},
+		{"file", nil, nil, []string{"*.sav"}, "a.sav", true},
+		{"file in a directory", nil, nil, []string{"*.sav"}, "dir/a.sav", false},
+		{"file excluded", nil, []string{"auto*"}, []string{"*.sav"}, "auto.sav", false},
+		{"case of an exclude", nil, []string{"*.LOG"}, nil, "game.log", !ignoreCase},
+		{"case of an include", []string{"Saves/**"}, nil, nil, "saves/a.sav", ignoreCase},
+		{"case of a file", nil, nil, []string{"SAVE*"}, "save1.sav", ignoreCase},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := NewFilter(test.include, test.exclude, test.files)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := filter.Match(test.path); got != test.want {
+				t.Errorf("Match(%q) = %v, want %v", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterExcluded(t *testing.T) {
+	tests := []struct {
+		exclude []string
+		files   []string
+		dir     string
+		want    bool
+	}{
+		{nil, nil, "saves", false},
+		{[]string{"ShaderCache"}, nil, "ShaderCache", true},
+		{[]string{"ShaderCache"}, nil, "gpu/ShaderCache", true},
+		{[]string{"ShaderCache"}, nil, "saves", false},
+		{[]string{"**/tmp"}, nil, "a/b/tmp", true},
+		{[]string{"logs/*.txt"}, nil, "logs", false},
+		{nil, []string{"*.sav"}, "saves", true},
+	}
+
+	for _, test := range tests {
+		filter, err := NewFilter(nil, test.exclude, test.files)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := filter.Excluded(test.dir); got != test.want {
+			t.Errorf("Excluded(%q) with exclude %q and files %q = %v, want %v", test.dir, test.exclude, test.files, got,
+				test.want)
+		}
+	}
+}
+
+func TestNewFilter(t *testing.T) {
+	if filter, err := NewFilter(nil, nil, nil); filter != nil || err != nil {
+		t.Errorf("NewFilter() = %v, %v, want nil", filter, err)
+	}
+
+	if _, err := NewFilter([]string{"["}, nil, nil); err == nil {
+		t.Error("NewFilter() with a bad pattern = nil, want an error")
+	}
+
+	if _, err := NewFilter(nil, nil, []string{"saves/*.sav"}); err == nil {
+		t.Error("NewFilter() with a file pattern containing / = nil, want an error")
+	}
+}
+
+// Scan leaves out the filtered files and never walks the excluded directories.
+func TestScanFilter(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"save.sav", "game.log", "slot1/save.sav", "slot1/cache/a.bin", "ShaderCache/a.bin"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter, err := NewFilter(nil, []string{"*.log", "ShaderCache", "**/cache"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := Scan(OSFS{}, dir, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, entry := range tree.Entries {
+		got = append(got, entry.Path)
+	}
+
+	if want := []string{"save.sav", "slot1", "slot1/save.sav"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Scan() = %q, want %q", got, want)
+	}
+}
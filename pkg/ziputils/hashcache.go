@@ -0,0 +1,66 @@
+package ziputils
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+type cachedHash struct {
+	Size int64 `json:"size"`
+	// ModTime is the modification time in nanoseconds since the Unix epoch.
+	ModTime int64  `json:"mtime"`
+	SHA256  string `json:"sha256"`
+}
+
+// HashCache remembers the SHA-256 of files by their path, size and modification time,
+// so a file is only read again after it changes.
+type HashCache struct {
+	mu    sync.Mutex
+	files map[string]cachedHash
+}
+
+// DecodeHashCache returns the cache encoded by Encode, it's empty if content is empty.
+func DecodeHashCache(content []byte) (*HashCache, error) {
+	cache := &HashCache{files: map[string]cachedHash{}}
+	if len(content) == 0 {
+		return cache, nil
+	}
+
+	if err := json.Unmarshal(content, &cache.files); err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+// Encode returns the content of the cache to save.
+func (c *HashCache) Encode() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Marshal(c.files)
+}
+
+func (c *HashCache) get(path string, entry *ManifestEntry) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.files[path]
+	if !ok || cached.Size != entry.Size || cached.ModTime != entry.ModTime {
+		return "", false
+	}
+
+	return cached.SHA256, true
+}
+
+func (c *HashCache) put(path string, entry *ManifestEntry) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[path] = cachedHash{entry.Size, entry.ModTime, entry.SHA256}
+}
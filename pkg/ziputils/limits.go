@@ -0,0 +1,118 @@
+package ziputils
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Limits bounds what an archive may expand to while it is extracted, 0 means unlimited.
+type Limits struct {
+	// MaxSize is the total uncompressed size in bytes.
+	MaxSize    int64
+	MaxEntries int
+	// MaxRatio is the total uncompressed size divided by the archive size.
+	MaxRatio float64
+}
+
+var DefaultLimits = Limits{
+	MaxSize:    16 << 30,
+	MaxEntries: 100000,
+	MaxRatio:   200,
+}
+
+// Small archives are allowed any ratio, a few megabytes of zeros compress very well.
+const minRatioCheckSize = 16 << 20
+
+// extractGuard enforces the limits on the entries of one archive, the entries
+// may be read concurrently.
+type extractGuard struct {
+	limits      Limits
+	archiveSize int64
+	mu          sync.Mutex
+	entries     int
+	// declared is the total size declared by the headers checked so far, written is the total
+	// size of the content read so far, which a corrupt header may understate.
+	declared int64
+	written  int64
+}
+
+// checkIndex checks the number of entries and their total size declared by the index of an
+// archive which has one, so it's rejected before any entry is extracted.
+func (g *extractGuard) checkIndex(entries int, size int64) error {
+	if g.limits.MaxEntries > 0 && entries > g.limits.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries", g.limits.MaxEntries)
+	}
+
+	return g.checkSize(size)
+}
+
+// check validates the header of the entry before anything of it is written, and wraps
+// its content so the limits are enforced while it is read.
+func (g *extractGuard) check(entry *archiveEntry) error {
+	if !entry.mode.IsRegular() && !entry.mode.IsDir() {
+		return fmt.Errorf("unsupported entry type %s: %s", entry.mode.Type(), entry.name)
+	}
+
+	if entry.size < 0 {
+		return fmt.Errorf("invalid entry size %d: %s", entry.size, entry.name)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.entries++
+	if g.limits.MaxEntries > 0 && g.entries > g.limits.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries", g.limits.MaxEntries)
+	}
+
+	g.declared += entry.size
+	if err := g.checkSize(g.declared); err != nil {
+		return err
+	}
+
+	open := entry.open
+	entry.open = func() (io.ReadCloser, error) {
+		content, err := open()
+		if err != nil {
+			return nil, err
+		}
+
+		return &guardedReader{content, g}, nil
+	}
+
+	return nil
+}
+
+func (g *extractGuard) add(n int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.written += int64(n)
+	return g.checkSize(g.written)
+}
+
+// checkSize checks the total uncompressed size against the size and ratio limits.
+func (g *extractGuard) checkSize(size int64) error {
+	if g.limits.MaxSize > 0 && size > g.limits.MaxSize {
+		return fmt.Errorf("archive expands to more than %d bytes", g.limits.MaxSize)
+	}
+
+	if g.limits.MaxRatio > 0 && size > minRatioCheckSize && float64(size) > g.limits.MaxRatio*float64(g.archiveSize) {
+		return fmt.Errorf("archive compression ratio is more than %g", g.limits.MaxRatio)
+	}
+
+	return nil
+}
+
+type guardedReader struct {
+	io.ReadCloser
+	guard *extractGuard
+}
+
+func (r *guardedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if guardErr := r.guard.add(n); guardErr != nil {
+		return n, guardErr
+	}
+
+	return n, err
+}
@@ -0,0 +1,224 @@
+package ziputils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type testEntry struct {
+	name    string
+	mode    os.FileMode
+	content string
+	// size is the size declared by the header instead of the size of content, the archive ends
+	// right after such a header.
+	size int64
+}
+
+// writeTestArchive writes the entries as they are into an archive of the format, so archives
+// which Archive never writes can be crafted.
+func writeTestArchive(t *testing.T, path string, format Format, entries []testEntry) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if format == FormatTarZstd {
+		writeTestTarZstd(t, file, entries)
+	} else {
+		writeTestZip(t, file, entries)
+	}
+}
+
+func writeTestZip(t *testing.T, file *os.File, entries []testEntry) {
+	zw := zip.NewWriter(file)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: time.Now()}
+		header.SetMode(entry.mode)
+		if entry.size != 0 {
+			header.Method = zip.Store
+			header.CRC32 = crc32.ChecksumIEEE([]byte(entry.content))
+			header.CompressedSize64 = uint64(len(entry.content))
+			header.UncompressedSize64 = uint64(entry.size)
+			w, err := zw.CreateRaw(header)
+			if err == nil {
+				_, err = w.Write([]byte(entry.content))
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			continue
+		}
+
+		w, err := zw.CreateHeader(header)
+		if err == nil {
+			_, err = w.Write([]byte(entry.content))
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTarZstd(t *testing.T, file *os.File, entries []testEntry) {
+	zw, err := zstd.NewWriter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tw := tar.NewWriter(zw)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: int64(entry.mode.Perm()), Size: int64(len(entry.content)),
+			ModTime: time.Now()}
+		switch {
+		case entry.mode.IsDir():
+			header.Typeflag, header.Size = tar.TypeDir, 0
+		case entry.mode&os.ModeSymlink != 0:
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, entry.content, 0
+		case entry.mode&os.ModeDevice != 0:
+			header.Typeflag, header.Size = tar.TypeChar, 0
+		default:
+			header.Typeflag = tar.TypeReg
+		}
+
+		if entry.size != 0 {
+			header.Size = entry.size
+			if err = tw.WriteHeader(header); err != nil {
+				t.Fatal(err)
+			}
+
+			// The content is never written, tw isn't closed since it would fail on it.
+			if err = tw.Flush(); err != nil && !strings.Contains(err.Error(), "missed writing") {
+				t.Fatal(err)
+			}
+
+			if err = zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			return
+		}
+
+		if err = tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+
+		if header.Size != 0 {
+			if _, err = tw.Write([]byte(entry.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	file := func(name string, size int) testEntry {
+		return testEntry{name: name, mode: 0644, content: strings.Repeat("x", size)}
+	}
+
+	zeros := testEntry{name: "zeros.bin", mode: 0644, content: strings.Repeat("\x00", minRatioCheckSize+1)}
+	tests := []struct {
+		name    string
+		entries []testEntry
+		limits  Limits
+		wantErr string
+	}{
+		{"within limits", []testEntry{file("a.sav", 10), file("b.sav", 10)}, DefaultLimits, ""},
+		{"entry count", []testEntry{file("a.sav", 1), file("b.sav", 1), file("c.sav", 1)},
+			Limits{MaxEntries: 2}, "more than 2 entries"},
+		{"total size", []testEntry{file("a.sav", 600), file("b.sav", 600)}, Limits{MaxSize: 1000},
+			"more than 1000 bytes"},
+		{"declared size", []testEntry{{name: "bomb.bin", mode: 0644, content: "x", size: 1 << 30}},
+			Limits{MaxSize: 1 << 20}, "more than 1048576 bytes"},
+		{"declared ratio", []testEntry{{name: "bomb.bin", mode: 0644, content: "x", size: 1 << 30}},
+			DefaultLimits, "compression ratio"},
+		{"ratio", []testEntry{zeros}, Limits{MaxRatio: 10}, "compression ratio"},
+		{"symlink", []testEntry{{name: "link", mode: os.ModeSymlink | 0777, content: "/etc/passwd"}},
+			DefaultLimits, "unsupported entry type"},
+		{"device node", []testEntry{{name: "tty", mode: os.ModeDevice | os.ModeCharDevice | 0644}},
+			DefaultLimits, "unsupported entry type"},
+		{"path traversal", []testEntry{file("../evil.sav", 10)}, DefaultLimits, "invalid file path"},
+		{"manifest size", []testEntry{file(ManifestName, maxManifestSize+1)}, Limits{}, "manifest is larger"},
+	}
+
+	for _, format := range []Format{FormatZip, FormatTarZstd} {
+		for i, test := range tests {
+			t.Run(string(format)+"/"+test.name, func(t *testing.T) {
+				dir := t.TempDir()
+				source := filepath.Join(dir, "test"+strconv.Itoa(i)+"."+format.Ext())
+				writeTestArchive(t, source, format, test.entries)
+				destination := filepath.Join(dir, "save")
+				err := Extract(OSFS{}, source, destination, test.limits)
+				if test.wantErr == "" {
+					if err != nil {
+						t.Fatalf("Extract() = %v, want nil", err)
+					}
+
+					return
+				}
+
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Extract() = %v, want error %q", err, test.wantErr)
+				}
+
+				if _, err = os.Stat(filepath.Join(dir, "evil.sav")); !os.IsNotExist(err) {
+					t.Errorf("a file is written outside of the destination")
+				}
+
+				if test.entries[0].size != 0 {
+					if _, err = os.Stat(filepath.Join(destination, test.entries[0].name)); !os.IsNotExist(err) {
+						t.Errorf("%s is written although its header breaks the limits", test.entries[0].name)
+					}
+				}
+			})
+		}
+	}
+}
+
+// A header understating the size of the content is caught by counting the bytes read.
+func TestExtractGuardCountsContent(t *testing.T) {
+	g := &extractGuard{limits: Limits{MaxSize: 100}, archiveSize: 1}
+	entry := &archiveEntry{name: "a.sav", mode: 0644, size: 10, open: func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 200))), nil
+	}}
+
+	if err := g.check(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := entry.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = io.Copy(ioutil.Discard, content); err == nil || !strings.Contains(err.Error(), "more than 100 bytes") {
+		t.Errorf("reading the content = %v, want the size limit error", err)
+	}
+}
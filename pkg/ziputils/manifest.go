@@ -0,0 +1,160 @@
+package ziputils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// ManifestName is the name of the manifest entry embedded in every archive.
+const ManifestName = ".gamesave-manifest.json"
+
+const manifestVersion = 1
+
+// maxManifestSize bounds the manifest read into memory, the manifest of
+// DefaultLimits.MaxEntries files is far smaller.
+const maxManifestSize = 64 << 20
+
+type ManifestEntry struct {
+	// Path is the slash separated path relative to the archived directory.
+	Path   string `json:"path"`
+	Dir    bool   `json:"dir,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+	// ModTime is the modification time in nanoseconds since the Unix epoch.
+	ModTime int64       `json:"mtime"`
+	Mode    os.FileMode `json:"mode"`
+}
+
+type Manifest struct {
+	Version int             `json:"version"`
+	Entries []ManifestEntry `json:"entries"`
+}
+
+func newManifestEntry(name string, info os.FileInfo) ManifestEntry {
+	entry := ManifestEntry{
+		Path:    name,
+		Dir:     info.IsDir(),
+		ModTime: info.ModTime().UnixNano(),
+		Mode:    info.Mode().Perm(),
+	}
+
+	if !entry.Dir {
+		entry.Size = info.Size()
+	}
+
+	return entry
+}
+
+func writeManifest(aw archiveWriter, manifest *Manifest) error {
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	entry := &ManifestEntry{
+		Path:    ManifestName,
+		Size:    int64(len(content)),
+		ModTime: time.Now().UnixNano(),
+		Mode:    0644,
+	}
+
+	return aw.writeFile(entry, bytes.NewReader(content))
+}
+
+func readManifest(entry *archiveEntry) (*Manifest, error) {
+	if entry.size > maxManifestSize {
+		return nil, fmt.Errorf("manifest is larger than %d bytes", maxManifestSize)
+	}
+
+	content, err := entry.open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(content, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("manifest is larger than %d bytes", maxManifestSize)
+	}
+
+	manifest := new(Manifest)
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	if manifest.Version > manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version: %d", manifest.Version)
+	}
+
+	return manifest, nil
+}
+
+// apply validates the extracted files against the manifest, creates the recorded
+// directories and restores the permissions and modification times.
+func (m *Manifest) apply(fs FS, destinations Destinations, extracted map[string]string) error {
+	for _, entry := range m.Entries {
+		if entry.Dir {
+			continue
+		}
+
+		sum, ok := extracted[entry.Path]
+		if !ok {
+			return fmt.Errorf("%s is missing from archive", entry.Path)
+		}
+
+		if sum != entry.SHA256 {
+			return fmt.Errorf("checksum mismatch: %s", entry.Path)
+		}
+
+		delete(extracted, entry.Path)
+	}
+
+	for name := range extracted {
+		return fmt.Errorf("%s is not in manifest", name)
+	}
+
+	for _, entry := range m.Entries {
+		if !entry.Dir {
+			continue
+		}
+
+		dirPath, err := destinations.resolve(entry.Path)
+		if err != nil {
+			return err
+		}
+
+		if err = fs.MkdirAll(dirPath, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	// Entries are recorded parent first, walk backwards so restoring the children
+	// doesn't change the modification time of their directory again.
+	for i := len(m.Entries) - 1; i >= 0; i-- {
+		entry := m.Entries[i]
+		filePath, err := destinations.resolve(entry.Path)
+		if err != nil {
+			return err
+		}
+
+		if err = fs.Chmod(filePath, entry.Mode.Perm()); err != nil {
+			return err
+		}
+
+		modTime := time.Unix(0, entry.ModTime)
+		if err = fs.Chtimes(filePath, modTime, modTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
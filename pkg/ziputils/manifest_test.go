@@ -0,0 +1,153 @@
+package ziputils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The files, the empty directories, the modes and the modification times to the nanosecond
+// come back as they were archived.
+func TestManifestRoundTrip(t *testing.T) {
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{"save.sav", "save", 0644},
+		{"slot1/save.sav", "slot1", 0600},
+		{"slot1/deep/data.bin", strings.Repeat("data", 1000), 0644},
+		{"empty.sav", "", 0644},
+	}
+
+	for _, format := range []Format{FormatZip, FormatZipStore, FormatTarZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "source")
+			mtime := time.Date(2024, 1, 31, 20, 0, 0, 123456789, time.UTC)
+			for i, file := range files {
+				path := filepath.Join(source, filepath.FromSlash(file.name))
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := ioutil.WriteFile(path, []byte(file.content), file.mode); err != nil {
+					t.Fatal(err)
+				}
+
+				at := mtime.Add(time.Duration(i) * time.Hour)
+				if err := os.Chtimes(path, at, at); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := os.MkdirAll(filepath.Join(source, "slot2", "empty"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			archivePath := filepath.Join(dir, "save."+format.Ext())
+			if err := Archive(OSFS{}, source, archivePath, Options{Format: format}); err != nil {
+				t.Fatal(err)
+			}
+
+			destination := filepath.Join(dir, "destination")
+			if err := Extract(OSFS{}, archivePath, destination, DefaultLimits); err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := Scan(OSFS{}, source, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Scan(OSFS{}, destination, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got.Entries) != len(want.Entries) {
+				t.Fatalf("extracted %d entries, want %d", len(got.Entries), len(want.Entries))
+			}
+
+			for i, entry := range got.Entries {
+				if runtime.GOOS == "windows" {
+					entry.Mode = want.Entries[i].Mode
+				}
+
+				if entry != want.Entries[i] {
+					t.Errorf("extracted %+v, want %+v", entry, want.Entries[i])
+				}
+			}
+
+			for _, file := range files {
+				content, err := ioutil.ReadFile(filepath.Join(destination, filepath.FromSlash(file.name)))
+				if err != nil || string(content) != file.content {
+					t.Errorf("%s = %q, %v, want %q", file.name, content, err, file.content)
+				}
+			}
+		})
+	}
+}
+
+// An archive whose files don't match its manifest is rejected.
+func TestExtractValidatesManifest(t *testing.T) {
+	sum := func(content string) string {
+		hash := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(hash[:])
+	}
+
+	manifest := func(entries ...ManifestEntry) testEntry {
+		content, err := json.Marshal(&Manifest{Version: manifestVersion, Entries: entries})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return testEntry{name: ManifestName, mode: 0644, content: string(content)}
+	}
+
+	file := testEntry{name: "save.sav", mode: 0644, content: "tampered"}
+	tests := []struct {
+		name    string
+		entries []testEntry
+		wantErr string
+	}{
+		{"valid", []testEntry{file, manifest(ManifestEntry{Path: "save.sav", Size: 8, SHA256: sum("tampered"),
+			Mode: 0644})}, ""},
+		{"tampered", []testEntry{file, manifest(ManifestEntry{Path: "save.sav", Size: 8, SHA256: sum("original"),
+			Mode: 0644})}, "checksum mismatch: save.sav"},
+		{"missing", []testEntry{file, manifest(ManifestEntry{Path: "save.sav", Size: 8, SHA256: sum("tampered"),
+			Mode: 0644}, ManifestEntry{Path: "other.sav", SHA256: sum(""), Mode: 0644})}, "other.sav is missing"},
+		{"added", []testEntry{file, manifest()}, "save.sav is not in manifest"},
+		{"newer version", []testEntry{file, {name: ManifestName, mode: 0644, content: `{"version":99}`}},
+			"unsupported manifest version"},
+	}
+
+	for _, format := range []Format{FormatZip, FormatTarZstd} {
+		for _, test := range tests {
+			t.Run(string(format)+"/"+test.name, func(t *testing.T) {
+				dir := t.TempDir()
+				source := filepath.Join(dir, "save."+format.Ext())
+				writeTestArchive(t, source, format, test.entries)
+				err := Extract(OSFS{}, source, filepath.Join(dir, "save"), DefaultLimits)
+				if test.wantErr == "" {
+					if err != nil {
+						t.Fatalf("Extract() = %v, want nil", err)
+					}
+
+					return
+				}
+
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Extract() = %v, want error %q", err, test.wantErr)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package ziputils
+
+import "sync"
+
+// workerPool runs jobs on a fixed number of goroutines and keeps the first error.
+type workerPool struct {
+	jobs chan func() error
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	err  error
+}
+
+func newWorkerPool(workers int) *workerPool {
+	p := &workerPool{jobs: make(chan func() error)}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				if p.failed() != nil {
+					continue
+				}
+
+				if err := job(); err != nil {
+					p.mu.Lock()
+					if p.err == nil {
+						p.err = err
+					}
+					p.mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	return p
+}
+
+func (p *workerPool) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// submit blocks until a worker takes the job, it returns the first error of earlier jobs.
+func (p *workerPool) submit(job func() error) error {
+	if err := p.failed(); err != nil {
+		return err
+	}
+
+	p.jobs <- job
+	return nil
+}
+
+// wait waits for the submitted jobs and returns the first error, the pool can't be used after.
+func (p *workerPool) wait() error {
+	close(p.jobs)
+	p.wg.Wait()
+	return p.err
+}
@@ -0,0 +1,144 @@
+package ziputils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Tree is a game save walked once, it's used both to detect changes and to archive it.
+type Tree struct {
+	// Entries are the selected files and directories, parents first. The SHA-256 of the
+	// files is filled in when they are archived.
+	Entries []ManifestEntry
+	// paths are the local paths of the entries.
+	paths []string
+	// root describes the scanned directory itself.
+	root     ManifestEntry
+	rootPath string
+}
+
+// Scan walks the regular files and directories under source selected by filter.
+func Scan(fs FS, source string, filter *Filter) (*Tree, error) {
+	tree := &Tree{rootPath: source}
+	err := fs.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == source {
+			tree.root = newManifestEntry("", info)
+			return nil
+		}
+
+		if !(info.IsDir() || info.Mode().IsRegular()) {
+			return nil
+		}
+
+		name, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+
+		name = filepath.ToSlash(name)
+		if info.IsDir() && filter.Excluded(name) {
+			return filepath.SkipDir
+		}
+
+		if filter.Match(name) {
+			tree.Entries = append(tree.Entries, newManifestEntry(name, info))
+			tree.paths = append(tree.paths, path)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// Add adds the scanned directory of sub and its entries under the top level directory name.
+func (t *Tree) Add(name string, sub *Tree) {
+	root := sub.root
+	root.Path = name
+	t.Entries = append(t.Entries, root)
+	t.paths = append(t.paths, sub.rootPath)
+	for i, entry := range sub.Entries {
+		entry.Path = name + "/" + entry.Path
+		t.Entries = append(t.Entries, entry)
+		t.paths = append(t.paths, sub.paths[i])
+	}
+}
+
+// ModTime returns the newest modification time of the files, nil if there is no file.
+func (t *Tree) ModTime() *time.Time {
+	var mtime *time.Time
+	for _, entry := range t.Entries {
+		if entry.Dir {
+			continue
+		}
+
+		modTime := time.Unix(0, entry.ModTime)
+		if mtime == nil || modTime.After(*mtime) {
+			mtime = &modTime
+		}
+	}
+
+	return mtime
+}
+
+// Hash returns the SHA-256 of the content of the tree, made of the paths of the entries and the
+// SHA-256 of the files. The files which are neither archived yet nor unchanged in cache are read
+// from fs to hash them, cache may be nil.
+func (t *Tree) Hash(fs FS, cache *HashCache) (string, error) {
+	hash := sha256.New()
+	for i := range t.Entries {
+		entry := &t.Entries[i]
+		if !entry.Dir && entry.SHA256 == "" {
+			sum, ok := cache.get(t.paths[i], entry)
+			if !ok {
+				var err error
+				if sum, err = hashFile(fs, t.paths[i]); err != nil {
+					return "", err
+				}
+			}
+
+			entry.SHA256 = sum
+		}
+
+		if !entry.Dir {
+			cache.put(t.paths[i], entry)
+		}
+
+		fmt.Fprintf(hash, "%s\x00%t\x00%s\n", entry.Path, entry.Dir, entry.SHA256)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashFile(fs FS, path string) (string, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// LocalPath returns the local path of the i-th entry.
+func (t *Tree) LocalPath(i int) string {
+	return t.paths[i]
+}
@@ -0,0 +1,124 @@
+package ziputils
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type tarZstdArchiveWriter struct {
+	zw *zstd.Encoder
+	tw *tar.Writer
+}
+
+func newTarZstdArchiveWriter(w io.Writer, opts Options) (archiveWriter, error) {
+	level := zstd.SpeedDefault
+	if opts.Level != 0 {
+		if opts.Level < 1 || opts.Level > 22 {
+			return nil, fmt.Errorf("invalid zstd compression level: %d", opts.Level)
+		}
+
+		level = zstd.EncoderLevelFromZstd(opts.Level)
+	}
+
+	zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(runtime.GOMAXPROCS(0)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &tarZstdArchiveWriter{zw, tar.NewWriter(zw)}, nil
+}
+
+func (w *tarZstdArchiveWriter) prepareFile(entry *ManifestEntry, content []byte) (interface{}, error) {
+	// The encoder compresses in parallel by itself, only reading is done ahead.
+	return content, nil
+}
+
+func (w *tarZstdArchiveWriter) writePrepared(entry *ManifestEntry, prepared interface{}) error {
+	return w.writeFile(entry, bytes.NewReader(prepared.([]byte)))
+}
+
+func (w *tarZstdArchiveWriter) writeFile(entry *ManifestEntry, r io.Reader) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entry.Path,
+		Size:     entry.Size,
+		Mode:     int64(entry.Mode.Perm()),
+		ModTime:  time.Unix(0, entry.ModTime),
+		// PAX keeps the sub-second part of the modification time
+		Format: tar.FormatPAX,
+	}
+
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := io.Copy(w.tw, r)
+	return err
+}
+
+func (w *tarZstdArchiveWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		w.zw.Close()
+		return err
+	}
+
+	return w.zw.Close()
+}
+
+type tarZstdArchiveReader struct {
+	file File
+	zr   *zstd.Decoder
+	tr   *tar.Reader
+}
+
+func openTarZstdArchiveReader(fs FS, source string) (archiveReader, error) {
+	file, err := fs.Open(source)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zstd.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &tarZstdArchiveReader{file, zr, tar.NewReader(zr)}, nil
+}
+
+func (r *tarZstdArchiveReader) next() (*archiveEntry, error) {
+	header, err := r.tr.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	info := header.FileInfo()
+	mode := info.Mode()
+	if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir && mode.IsRegular() {
+		// Such as hard links, which FileInfo reports as regular files
+		mode |= os.ModeIrregular
+	}
+
+	return &archiveEntry{
+		name:    header.Name,
+		mode:    mode,
+		modTime: info.ModTime(),
+		size:    header.Size,
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(r.tr), nil
+		},
+	}, nil
+}
+
+func (r *tarZstdArchiveReader) Close() error {
+	r.zr.Close()
+	return r.file.Close()
+}
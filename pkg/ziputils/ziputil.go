@@ -2,158 +2,179 @@ package ziputils
 
 import (
 	"archive/zip"
+	"bytes"
+	"compress/flate"
 	"fmt"
+	"hash/crc32"
 	"io"
-	"log"
-	"os"
-	"path/filepath"
-	"strings"
+	"math"
 	"time"
 )
 
+// ZipSource packs source into a deflate zip archive.
 func ZipSource(source, destination string) error {
-	writer, err := os.Create(destination)
-	if err != nil {
-		return err
-	}
-
-	zw := zip.NewWriter(writer)
-	defer func() {
-		err = zw.Close()
-		if err != nil {
-			log.Println(err)
-		}
-
-		err = writer.Close()
-		if err != nil {
-			log.Println(err)
-		}
-	}()
-	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	return Archive(OSFS{}, source, destination, Options{Format: FormatZip})
+}
 
-		if info.Mode().IsRegular() {
-			return addFileToZip(zw, path, source)
-		}
+// UnzipSource unpacks a zip archive into destination.
+func UnzipSource(source, destination string) error {
+	return Extract(OSFS{}, source, destination, DefaultLimits)
+}
 
-		return nil
-	})
+// defaultDeflateLevel is the level archive/zip deflates with, which is faster than
+// flate.DefaultCompression at nearly the same size.
+const defaultDeflateLevel = 5
 
-	return err
+type zipArchiveWriter struct {
+	zw     *zip.Writer
+	method uint16
+	level  int
 }
 
-func addFileToZip(zipWriter *zip.Writer, filename string, dirname string) error {
-	fileToZip, err := os.Open(filename)
-	if err != nil {
-		return err
-	}
-	defer fileToZip.Close()
-
-	// Get the file information
-	info, err := fileToZip.Stat()
-	if err != nil {
-		return err
+func newZipArchiveWriter(w io.Writer, opts Options) (archiveWriter, error) {
+	zw := zip.NewWriter(w)
+	if opts.Format == FormatZipStore {
+		return &zipArchiveWriter{zw, zip.Store, 0}, nil
 	}
 
-	header, err := zip.FileInfoHeader(info)
-	if err != nil {
-		return err
+	level := opts.Level
+	if level == 0 {
+		level = defaultDeflateLevel
 	}
 
-	// Using FileInfoHeader() above only uses the basename of the file. If we want
-	// to preserve the folder structure we can overwrite this with the full path.
-	if len(dirname) < len(filename) && strings.HasPrefix(filename, dirname) {
-		header.Name = filename[len(dirname):]
-		if header.Name[0] == filepath.Separator {
-			header.Name = header.Name[1:]
-		}
-	} else {
-		header.Name = filepath.Base(filename)
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return nil, fmt.Errorf("invalid deflate compression level: %d", opts.Level)
 	}
 
-	// Change to deflate to gain better compression
-	// see http://golang.org/pkg/archive/zip/#pkg-constants
-	header.Method = zip.Deflate
+	zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	})
 
-	writer, err := zipWriter.CreateHeader(header)
-	if err != nil {
-		return err
-	}
-	_, err = io.Copy(writer, fileToZip)
-	return err
+	return &zipArchiveWriter{zw, zip.Deflate, level}, nil
 }
 
-func UnzipSource(source, destination string) error {
-	// 1. Open the zip file
-	reader, err := zip.OpenReader(source)
-	if err != nil {
-		return err
+func (w *zipArchiveWriter) newHeader(entry *ManifestEntry) *zip.FileHeader {
+	header := &zip.FileHeader{
+		Name:     entry.Path,
+		Method:   w.method,
+		Modified: time.Unix(0, entry.ModTime),
 	}
-	defer reader.Close()
+	header.SetMode(entry.Mode)
+	return header
+}
 
-	// 2. Get the absolute destination path
-	destination, err = filepath.Abs(destination)
+func (w *zipArchiveWriter) writeFile(entry *ManifestEntry, r io.Reader) error {
+	writer, err := w.zw.CreateHeader(w.newHeader(entry))
 	if err != nil {
 		return err
 	}
 
-	// 3. Iterate over zip files inside the archive and unzip each of them
-	for _, f := range reader.File {
-		err := unzipFile(f, destination)
-		if err != nil {
-			return err
-		}
-	}
+	_, err = io.Copy(writer, r)
+	return err
+}
 
-	return nil
+type zipPreparedFile struct {
+	header *zip.FileHeader
+	data   []byte
 }
 
-func unzipFile(f *zip.File, destination string) error {
-	// 4. Check if file paths are not vulnerable to Zip Slip
-	filePath := filepath.Join(destination, f.Name)
-	if !strings.HasPrefix(filePath, filepath.Clean(destination)+string(os.PathSeparator)) {
-		return fmt.Errorf("invalid file path: %s", filePath)
+func (w *zipArchiveWriter) prepareFile(entry *ManifestEntry, content []byte) (interface{}, error) {
+	header := w.newHeader(entry)
+	header.CRC32 = crc32.ChecksumIEEE(content)
+	header.UncompressedSize64 = uint64(len(content))
+	if w.method == zip.Store {
+		header.CompressedSize64 = header.UncompressedSize64
+		return &zipPreparedFile{header, content}, nil
 	}
 
-	// 5. Create directory tree
-	if f.FileInfo().IsDir() {
-		if err := os.MkdirAll(filePath, os.ModePerm); err != nil {
-			return err
-		}
-		return nil
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, w.level)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
-		return err
+	if _, err = fw.Write(content); err != nil {
+		return nil, err
 	}
 
-	// 6. Create a destination file for unzipped content
-	destinationFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-	if err != nil {
-		return err
+	if err = fw.Close(); err != nil {
+		return nil, err
 	}
-	defer destinationFile.Close()
 
-	// 7. Unzip the content of a file and copy it to the destination file
-	zippedFile, err := f.Open()
+	header.CompressedSize64 = uint64(buf.Len())
+	return &zipPreparedFile{header, buf.Bytes()}, nil
+}
+
+func (w *zipArchiveWriter) writePrepared(entry *ManifestEntry, prepared interface{}) error {
+	p := prepared.(*zipPreparedFile)
+	writer, err := w.zw.CreateRaw(p.header)
 	if err != nil {
 		return err
 	}
-	defer zippedFile.Close()
 
-	if _, err := io.Copy(destinationFile, zippedFile); err != nil {
-		return err
+	_, err = writer.Write(p.data)
+	return err
+}
+
+func (w *zipArchiveWriter) Close() error {
+	return w.zw.Close()
+}
+
+type zipArchiveReader struct {
+	file   File
+	reader *zip.Reader
+	idx    int
+}
+
+func openZipArchiveReader(fs FS, source string) (archiveReader, error) {
+	file, err := fs.Open(source)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := destinationFile.Close(); err != nil {
-		return err
+	info, err := file.Stat()
+	if err == nil {
+		var reader *zip.Reader
+		if reader, err = zip.NewReader(file, info.Size()); err == nil {
+			return &zipArchiveReader{file: file, reader: reader}, nil
+		}
 	}
 
-	if err := os.Chtimes(filePath, time.Now(), f.FileInfo().ModTime()); err != nil {
-		return err
+	file.Close()
+	return nil, err
+}
+
+func (r *zipArchiveReader) next() (*archiveEntry, error) {
+	if r.idx >= len(r.reader.File) {
+		return nil, io.EOF
+	}
+
+	f := r.reader.File[r.idx]
+	r.idx++
+	info := f.FileInfo()
+	return &archiveEntry{
+		name:       f.Name,
+		mode:       info.Mode(),
+		modTime:    info.ModTime(),
+		size:       int64(f.UncompressedSize64),
+		open:       f.Open,
+		concurrent: true,
+	}, nil
+}
+
+func (r *zipArchiveReader) index() (int, int64) {
+	var size int64
+	for _, f := range r.reader.File {
+		if f.UncompressedSize64 > math.MaxInt64-uint64(size) {
+			return len(r.reader.File), math.MaxInt64
+		}
+
+		size += int64(f.UncompressedSize64)
 	}
 
-	return nil
+	return len(r.reader.File), size
+}
+
+func (r *zipArchiveReader) Close() error {
+	return r.file.Close()
 }